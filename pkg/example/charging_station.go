@@ -10,6 +10,7 @@ import (
 
 type ChargingStation struct {
 	chargingStationID string
+	clock             fsm.Clock
 	machine           *fsm.Machine
 	mu                sync.Mutex
 	connectorByID     map[int]*Connector
@@ -17,9 +18,11 @@ type ChargingStation struct {
 
 func NewChargingStation(
 	chargingStationID string,
+	clock fsm.Clock,
 ) (*ChargingStation, error) {
 	c := ChargingStation{
 		chargingStationID: chargingStationID,
+		clock:             clock,
 		connectorByID:     make(map[int]*Connector),
 	}
 
@@ -84,6 +87,7 @@ func NewChargingStation(
 			shutdown,
 		},
 		uninitialised,
+		c.getMachineOptions()...,
 	)
 	if err != nil {
 		return nil, err
@@ -149,6 +153,17 @@ func (c *ChargingStation) AddConnector(ctx context.Context, connectorID int) (*C
 	return connector, nil
 }
 
+// built afresh for each machine so per-machine options (e.g. a store ID or restored state) are never shared
+func (c *ChargingStation) getMachineOptions() []fsm.MachineOption {
+	machineOptions := make([]fsm.MachineOption, 0)
+
+	if c.clock != nil {
+		machineOptions = append(machineOptions, fsm.WithClock(c.clock))
+	}
+
+	return machineOptions
+}
+
 func (c *ChargingStation) GetChargingStationID() string {
 	return c.chargingStationID
 }
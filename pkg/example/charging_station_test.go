@@ -2,9 +2,11 @@ package example
 
 import (
 	"context"
+	"github.com/initialed85/stato/pkg/fsm/fsmtest"
 	"github.com/stretchr/testify/require"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestChargingStation(t *testing.T) {
@@ -13,7 +15,7 @@ func TestChargingStation(t *testing.T) {
 
 	// us provisioning the charger
 
-	chargingStation, err := NewChargingStation("test_001")
+	chargingStation, err := NewChargingStation("test_001", nil)
 	require.NoError(t, err)
 	require.Equal(t, Unitialised, chargingStation.State())
 
@@ -72,4 +74,69 @@ func TestChargingStation(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, Charging, connector.State())
 
+	// us stopping charging
+
+	err = connector.RemoteStop(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Finishing, connector.State())
+
+	// the charger faulting and then recovering
+
+	err = connector.HandleStatusNotification(ctx, Faulted)
+	require.NoError(t, err)
+	require.Equal(t, Faulted, connector.State())
+
+	err = connector.Resume(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Finishing, connector.State())
+}
+
+func TestChargingStationTimeouts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := fsmtest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	chargingStation, err := NewChargingStation("test_002", clock)
+	require.NoError(t, err)
+
+	err = chargingStation.Configure(ctx)
+	require.NoError(t, err)
+
+	err = chargingStation.HandleBootNotification(ctx, "ACME Charger 1")
+	require.NoError(t, err)
+
+	connector, err := chargingStation.AddConnector(ctx, 1)
+	require.NoError(t, err)
+
+	err = connector.HandleStatusNotification(ctx, Available)
+	require.NoError(t, err)
+
+	// user plugging in their ev and walking away
+
+	err = connector.HandleStatusNotification(ctx, Preparing)
+	require.NoError(t, err)
+	require.Equal(t, Preparing, connector.State())
+
+	clock.Advance(PreparingTimeout - time.Second)
+	require.Equal(t, Preparing, connector.State())
+
+	clock.Advance(time.Second)
+	require.Equal(t, Available, connector.State())
+
+	// us starting charging but the charger never starting the transaction
+
+	err = connector.HandleStatusNotification(ctx, Preparing)
+	require.NoError(t, err)
+
+	transaction, err := connector.RemoteStart(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Charging, connector.State())
+	require.Equal(t, Initialised, transaction.State())
+
+	clock.Advance(StartTimeout)
+	require.Equal(t, Failed, transaction.State())
+
+	err = transaction.HandleStart(ctx, transaction.GetTransactionID())
+	require.Error(t, err)
 }
@@ -43,38 +43,58 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 
 	preparing := fsm.NewState(
 		Preparing,
-		c.onOccupied,
 		nil,
+		nil,
+		fsm.WithTimeout(PreparingTimeout, Expire),
 	)
 
 	charging := fsm.NewState(
 		Charging,
-		c.onOccupied,
+		nil,
 		nil,
 	)
 
 	suspendedEV := fsm.NewState(
 		SuspendedEV,
-		c.onOccupied,
+		nil,
 		nil,
 	)
 
 	suspendedEVSE := fsm.NewState(
 		SuspendedEVSE,
-		c.onOccupied,
+		nil,
 		nil,
 	)
 
 	finishing := fsm.NewState(
 		Finishing,
+		nil,
+		nil,
+	)
+
+	occupied := fsm.NewState(
+		Occupied,
 		c.onOccupied,
 		nil,
+		fsm.WithChildren(
+			preparing,
+			charging,
+			suspendedEV,
+			suspendedEVSE,
+			finishing,
+		),
+	)
+
+	occupiedHistory := fsm.NewShallowHistory(
+		OccupiedHistory,
+		occupied,
 	)
 
 	reserved := fsm.NewState(
 		Reserved,
 		c.onUnavailable,
 		nil,
+		fsm.WithTimeout(ReservationTimeout, Expire),
 	)
 
 	unavailable := fsm.NewState(
@@ -91,6 +111,19 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 
 	transitions := make([]*fsm.Transition, 0)
 
+	// a slice rather than the maps below so transitions are declared in a stable order
+	statuses := []*fsm.State{
+		available,
+		preparing,
+		charging,
+		suspendedEV,
+		suspendedEVSE,
+		finishing,
+		reserved,
+		unavailable,
+		faulted,
+	}
+
 	alpha := map[string]*fsm.State{
 		"A": available,
 		"B": preparing,
@@ -115,7 +148,7 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		"9": faulted,
 	}
 
-	for _, destinationState := range alpha {
+	for _, destinationState := range statuses {
 		transitions = append(
 			transitions,
 			fsm.NewTransition(
@@ -128,7 +161,7 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		)
 	}
 
-	for _, destinationState := range alpha {
+	for _, destinationState := range statuses {
 		transitions = append(
 			transitions,
 			fsm.NewTransition(
@@ -143,11 +176,11 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 
 	permutations := []string{
 		"__", "A2", "A3", "A4", "A5", "__", "A7", "A8", "A9",
-		"B1", "__", "B3", "B4", "B5", "B6", "__", "__", "B9",
-		"C1", "__", "__", "C4", "C5", "C6", "__", "C8", "C9",
-		"D1", "__", "D3", "__", "D5", "D6", "__", "D8", "D9",
-		"E1", "__", "E3", "E4", "__", "E6", "__", "E8", "E9",
-		"F1", "F2", "__", "__", "__", "__", "__", "F8", "F9",
+		"B1", "__", "B3", "B4", "B5", "B6", "__", "__", "__",
+		"C1", "__", "__", "C4", "C5", "C6", "__", "__", "__",
+		"D1", "__", "D3", "__", "D5", "D6", "__", "__", "__",
+		"E1", "__", "E3", "E4", "__", "E6", "__", "__", "__",
+		"F1", "F2", "__", "__", "__", "__", "__", "__", "__",
 		"G1", "G2", "__", "__", "__", "__", "__", "G8", "G9",
 		"H1", "H2", "H3", "H4", "H5", "__", "__", "__", "H9",
 		"I1", "I2", "I3", "I4", "I5", "I6", "I7", "I8", "__",
@@ -176,6 +209,27 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		)
 	}
 
+	for _, destinationState := range []*fsm.State{unavailable, faulted} {
+		transitions = append(
+			transitions,
+			fsm.NewTransition(
+				fmt.Sprintf("%v%v", HandleStatusNotification, destinationState.Name()),
+				occupied,
+				destinationState,
+				nil,
+				nil,
+			),
+		)
+	}
+
+	remoteStartEvent := fsm.NewEvent(RemoteStart)
+
+	remoteStopEvent := fsm.NewEvent(RemoteStop)
+
+	resumeEvent := fsm.NewEvent(Resume)
+
+	expireEvent := fsm.NewEvent(Expire)
+
 	configure := fsm.NewTransition(
 		Configure,
 		uninitialised,
@@ -190,6 +244,8 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		charging,
 		c.onRemoteStart,
 		c.onCharging,
+		fsm.WithEvent(remoteStartEvent),
+		fsm.WithGuard(c.canRemoteStart),
 	)
 
 	remoteStart2 := fsm.NewTransition(
@@ -198,6 +254,8 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		charging,
 		c.onRemoteStart,
 		c.onCharging,
+		fsm.WithEvent(remoteStartEvent),
+		fsm.WithGuard(c.canRemoteStart),
 	)
 
 	remoteStop1 := fsm.NewTransition(
@@ -206,6 +264,8 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		finishing,
 		nil,
 		c.onFinishing,
+		fsm.WithEvent(remoteStopEvent),
+		fsm.WithGuard(c.canRemoteStopTransaction),
 	)
 
 	remoteStop2 := fsm.NewTransition(
@@ -214,6 +274,8 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		finishing,
 		nil,
 		c.onFinishing,
+		fsm.WithEvent(remoteStopEvent),
+		fsm.WithGuard(c.canRemoteStopTransaction),
 	)
 
 	remoteStop3 := fsm.NewTransition(
@@ -222,6 +284,62 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 		finishing,
 		nil,
 		c.onFinishing,
+		fsm.WithEvent(remoteStopEvent),
+		fsm.WithGuard(c.canRemoteStopTransaction),
+	)
+
+	remoteStop4 := fsm.NewTransition(
+		RemoteStop,
+		charging,
+		available,
+		nil,
+		nil,
+		fsm.WithEvent(remoteStopEvent),
+	)
+
+	remoteStop5 := fsm.NewTransition(
+		RemoteStop,
+		suspendedEV,
+		available,
+		nil,
+		nil,
+		fsm.WithEvent(remoteStopEvent),
+	)
+
+	remoteStop6 := fsm.NewTransition(
+		RemoteStop,
+		suspendedEVSE,
+		available,
+		nil,
+		nil,
+		fsm.WithEvent(remoteStopEvent),
+	)
+
+	resume := fsm.NewTransition(
+		Resume,
+		faulted,
+		occupiedHistory,
+		nil,
+		nil,
+		fsm.WithEvent(resumeEvent),
+	)
+
+	expire1 := fsm.NewTransition(
+		Expire,
+		preparing,
+		available,
+		nil,
+		nil,
+		fsm.WithEvent(expireEvent),
+	)
+
+	expire2 := fsm.NewTransition(
+		Expire,
+		reserved,
+		available,
+		nil,
+		nil,
+		fsm.WithEvent(expireEvent),
 	)
 
 	transitions = append(
@@ -233,6 +351,12 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 			remoteStop1,
 			remoteStop2,
 			remoteStop3,
+			remoteStop4,
+			remoteStop5,
+			remoteStop6,
+			resume,
+			expire1,
+			expire2,
 		}...,
 	)
 
@@ -241,17 +365,14 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 			uninitialised,
 			initialised,
 			available,
-			preparing,
-			charging,
-			suspendedEV,
-			suspendedEVSE,
-			finishing,
+			occupied,
 			reserved,
 			unavailable,
 			faulted,
 		},
 		transitions,
 		uninitialised,
+		chargingStation.getMachineOptions()...,
 	)
 	if err != nil {
 		return nil, err
@@ -262,6 +383,20 @@ func NewConnector(chargingStation *ChargingStation, connectorID int) (*Connector
 	return &c, nil
 }
 
+func (c *Connector) canRemoteStart(scope fsm.Scope) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.transaction == nil
+}
+
+func (c *Connector) canRemoteStopTransaction(scope fsm.Scope) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.transaction != nil
+}
+
 func (c *Connector) onInitialised(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v created if it didn't exist",
@@ -273,7 +408,7 @@ func (c *Connector) onInitialised(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onAvailable(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v available (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -281,7 +416,7 @@ func (c *Connector) onAvailable(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onOccupied(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v occupied (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -289,7 +424,7 @@ func (c *Connector) onOccupied(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onUnavailable(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v unavailable (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -297,7 +432,7 @@ func (c *Connector) onUnavailable(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onFaulted(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v faulted (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -306,19 +441,21 @@ func (c *Connector) onRemoteStart(scope fsm.Scope) (context.Context, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.transaction != nil {
-		return nil, fmt.Errorf(
-			"connector %#+v already in transaction %#+v",
-			c.connectorID, c.transaction.GetTransactionID(),
-		)
-	}
-
 	transaction, err := NewTransaction(c.chargingStation, c)
 	if err != nil {
 		return nil, err
 	}
 	c.transaction = transaction
 
+	scope.Compensate(func(ctx context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.transaction = nil
+
+		return nil
+	})
+
 	scope.Context = context.WithValue(scope.Context, "transaction", transaction)
 
 	return scope.Context, nil
@@ -327,7 +464,7 @@ func (c *Connector) onRemoteStart(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onCharging(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v EV charging underway (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -335,7 +472,7 @@ func (c *Connector) onCharging(scope fsm.Scope) (context.Context, error) {
 func (c *Connector) onFinishing(scope fsm.Scope) (context.Context, error) {
 	log.Printf(
 		"%v:%v EV charging finished (%v)",
-		c.chargingStation.GetChargingStationID(), c.connectorID, c.State(),
+		c.chargingStation.GetChargingStationID(), c.connectorID, scope.Destination,
 	)
 	return scope.Context, nil
 }
@@ -372,9 +509,9 @@ func (c *Connector) Configure(ctx context.Context) (err error) {
 }
 
 func (c *Connector) HandleStatusNotification(ctx context.Context, status string) (err error) {
-	ctx, err = c.machine.Transition(
-		fmt.Sprintf("%v%v", HandleStatusNotification, status),
+	ctx, err = c.machine.ChangeState(
 		context.WithValue(ctx, "status", status),
+		status,
 	)
 	if err != nil {
 		return err
@@ -384,7 +521,7 @@ func (c *Connector) HandleStatusNotification(ctx context.Context, status string)
 }
 
 func (c *Connector) RemoteStart(ctx context.Context) (transaction *Transaction, err error) {
-	ctx, err = c.machine.Transition(RemoteStart, ctx)
+	ctx, err = c.machine.Fire(ctx, RemoteStart, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -422,7 +559,16 @@ func (c *Connector) HandleStart(ctx context.Context, transactionID int64) (err e
 }
 
 func (c *Connector) RemoteStop(ctx context.Context) (err error) {
-	ctx, err = c.machine.Transition(RemoteStop, ctx)
+	ctx, err = c.machine.Fire(ctx, RemoteStop, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Connector) Resume(ctx context.Context) (err error) {
+	ctx, err = c.machine.Fire(ctx, Resume, nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,36 @@
+package example
+
+import (
+	"flag"
+	"github.com/initialed85/stato/pkg/fsm"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the diagrams in docs")
+
+func requireDiagram(t *testing.T, path string, diagram string) {
+	if *update {
+		err := os.WriteFile(path, []byte(diagram), 0o644)
+		require.NoError(t, err)
+	}
+
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), diagram, "run go test ./pkg/example -update to regenerate %v", path)
+}
+
+func TestConnectorDiagram(t *testing.T) {
+	chargingStation, err := NewChargingStation("test_001", nil)
+	require.NoError(t, err)
+
+	connector, err := NewConnector(chargingStation, 1)
+	require.NoError(t, err)
+
+	opts := []fsm.ExportOption{fsm.WithDiagramName("connector"), fsm.WithCurrentState(false)}
+
+	requireDiagram(t, "../../docs/connector.dot", fsm.ExportDOT(connector.machine, opts...))
+	requireDiagram(t, "../../docs/connector.mmd", fsm.ExportMermaid(connector.machine, opts...))
+	requireDiagram(t, "../../docs/connector.puml", fsm.ExportPlantUML(connector.machine, opts...))
+}
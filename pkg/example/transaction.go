@@ -46,6 +46,7 @@ func NewTransaction(
 		Initialised,
 		t.onInitialised,
 		nil,
+		fsm.WithTimeout(StartTimeout, Fail),
 	)
 
 	charging := fsm.NewState(
@@ -104,6 +105,14 @@ func NewTransaction(
 		nil,
 	)
 
+	fail := fsm.NewTransition(
+		Fail,
+		initialised,
+		failed,
+		nil,
+		nil,
+	)
+
 	machine, err := fsm.NewMachine(
 		[]*fsm.State{
 			uninitialised,
@@ -118,8 +127,10 @@ func NewTransaction(
 			handleStart,
 			meterValues,
 			handleStop,
+			fail,
 		},
 		uninitialised,
+		chargingStation.getMachineOptions()...,
 	)
 	if err != nil {
 		return nil, err
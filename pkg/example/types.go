@@ -1,20 +1,30 @@
 package example
 
+import "time"
+
+const (
+	PreparingTimeout   = time.Minute * 2
+	ReservationTimeout = time.Minute * 15
+	StartTimeout       = time.Minute * 1
+)
+
 const (
-	Unitialised   = "Unitialised"
-	Initialised   = "Initialised"
-	Available     = "Available"
-	Preparing     = "Preparing"
-	Charging      = "Charging"
-	SuspendedEV   = "SuspendedEV"
-	SuspendedEVSE = "SuspendedEVSE"
-	Finishing     = "Finishing"
-	Reserved      = "Reserved"
-	Unavailable   = "Unavailable"
-	Faulted       = "Faulted"
-	Parking       = "Parking"
-	Done          = "Done"
-	Failed        = "Failed"
+	Unitialised     = "Unitialised"
+	Initialised     = "Initialised"
+	Available       = "Available"
+	Occupied        = "Occupied"
+	OccupiedHistory = "OccupiedHistory"
+	Preparing       = "Preparing"
+	Charging        = "Charging"
+	SuspendedEV     = "SuspendedEV"
+	SuspendedEVSE   = "SuspendedEVSE"
+	Finishing       = "Finishing"
+	Reserved        = "Reserved"
+	Unavailable     = "Unavailable"
+	Faulted         = "Faulted"
+	Parking         = "Parking"
+	Done            = "Done"
+	Failed          = "Failed"
 
 	Configure                = "Configure"
 	HandleBootNotification   = "HandleBootNotification"
@@ -31,4 +41,6 @@ const (
 	UnplugEV                 = "UnplugEV"
 	Cordon                   = "Cordon"
 	Shutdown                 = "Shutdown"
+	Expire                   = "Expire"
+	Fail                     = "Fail"
 )
@@ -0,0 +1,135 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+type Result struct {
+	Context context.Context
+	Err     error
+}
+
+type asyncRequest struct {
+	request
+	result chan Result
+}
+
+type AsyncMachine struct {
+	machine  *Machine
+	mu       *sync.RWMutex
+	stopped  bool
+	senders  *sync.WaitGroup
+	requests chan asyncRequest
+	done     chan struct{}
+}
+
+func NewAsyncMachine(
+	machine *Machine,
+	bufferSize int,
+) *AsyncMachine {
+	a := AsyncMachine{
+		machine:  machine,
+		mu:       new(sync.RWMutex),
+		senders:  new(sync.WaitGroup),
+		requests: make(chan asyncRequest, bufferSize),
+		done:     make(chan struct{}),
+	}
+
+	go a.run()
+
+	return &a
+}
+
+func (a *AsyncMachine) run() {
+	defer close(a.done)
+
+	for r := range a.requests {
+		err := r.ctx.Err()
+		if err != nil {
+			r.result <- Result{Err: err}
+			continue
+		}
+
+		ctx, err := a.machine.dispatch(r.ctx, r.request)
+		r.result <- Result{Context: ctx, Err: err}
+	}
+}
+
+func (a *AsyncMachine) submit(ctx context.Context, r request) <-chan Result {
+	result := make(chan Result, 1)
+
+	// a request from a callback on the event loop can't wait for the loop, so it joins the machine's queue
+	queued, err := a.machine.enqueue(ctx, r)
+	if err != nil {
+		result <- Result{Err: err}
+		return result
+	}
+
+	if queued {
+		result <- Result{Context: ctx}
+		return result
+	}
+
+	a.mu.RLock()
+	if a.stopped {
+		a.mu.RUnlock()
+		result <- Result{Err: errorf(ErrStopped, "async machine stopped, cannot handle %v", r)}
+		return result
+	}
+	a.senders.Add(1)
+	a.mu.RUnlock()
+
+	defer a.senders.Done()
+
+	r.ctx = ctx
+
+	select {
+	case a.requests <- asyncRequest{request: r, result: result}:
+	case <-ctx.Done():
+		result <- Result{Err: ctx.Err()}
+	}
+
+	return result
+}
+
+func (a *AsyncMachine) State() string {
+	return a.machine.State()
+}
+
+func (a *AsyncMachine) Snapshot() Snapshot {
+	return a.machine.Snapshot()
+}
+
+func (a *AsyncMachine) Transition(ctx context.Context, name string) <-chan Result {
+	return a.submit(ctx, request{kind: transitionRequest, name: name})
+}
+
+func (a *AsyncMachine) Fire(ctx context.Context, event string, payload any) <-chan Result {
+	return a.submit(ctx, request{kind: fireRequest, name: event, payload: payload})
+}
+
+func (a *AsyncMachine) ChangeState(ctx context.Context, destination string) <-chan Result {
+	return a.submit(ctx, request{kind: changeStateRequest, name: destination})
+}
+
+func (a *AsyncMachine) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.stopped {
+		a.stopped = true
+
+		// requests is only closed once submissions already past the stopped check have been sent
+		go func() {
+			a.senders.Wait()
+			close(a.requests)
+		}()
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package fsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAsyncMachine(t *testing.T) {
+	release := make(chan struct{})
+	stateBEnterCallCount := 0
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			<-release
+			stateBEnterCallCount++
+			return scope.Context, nil
+		},
+		nil,
+	)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil, WithEvent(NewEvent("event_a_b"))),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	a := NewAsyncMachine(m, 8)
+
+	results := []<-chan Result{
+		a.Fire(context.Background(), "event_a_b", nil),
+		a.Transition(context.Background(), "transition_b_a"),
+		a.ChangeState(context.Background(), stateB.Name()),
+		a.Fire(context.Background(), "event_a_b", nil),
+		a.Transition(context.Background(), "transition_unknown"),
+	}
+
+	require.Equal(t, stateA.Name(), a.State())
+
+	close(release)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- a.Stop(context.Background())
+	}()
+
+	result := <-results[0]
+	require.NoError(t, result.Err)
+	require.NotNil(t, result.Context)
+
+	result = <-results[1]
+	require.NoError(t, result.Err)
+
+	result = <-results[2]
+	require.Error(t, result.Err)
+
+	result = <-results[3]
+	require.NoError(t, result.Err)
+
+	result = <-results[4]
+	require.Error(t, result.Err)
+
+	require.NoError(t, <-stopped)
+	require.Equal(t, stateB.Name(), a.State())
+	require.Equal(t, 2, stateBEnterCallCount)
+
+	result = <-a.Transition(context.Background(), "transition_b_a")
+	require.Error(t, result.Err)
+	require.Equal(t, stateB.Name(), a.State())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a = NewAsyncMachine(m, 0)
+
+	result = <-a.Transition(ctx, "transition_b_a")
+	require.ErrorIs(t, result.Err, context.Canceled)
+
+	require.NoError(t, a.Stop(context.Background()))
+	require.Equal(t, stateB.Name(), a.State())
+}
+
+func TestAsyncMachineReentrant(t *testing.T) {
+	var a *AsyncMachine
+
+	stateA := NewState("state_a", nil, nil)
+	stateC := NewState("state_c", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			result := <-a.Fire(scope.Context, "event_b_c", nil)
+			return result.Context, result.Err
+		},
+		nil,
+	)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_c", stateB, stateC, nil, nil, WithEvent(NewEvent("event_b_c"))),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	a = NewAsyncMachine(m, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	result := <-a.Transition(ctx, "transition_a_b")
+	require.NoError(t, result.Err)
+	require.Equal(t, stateC.Name(), a.State())
+
+	require.NoError(t, a.Stop(ctx))
+}
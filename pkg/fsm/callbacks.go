@@ -3,10 +3,33 @@ package fsm
 import "context"
 
 type Scope struct {
-	Transition  string
-	Source      string
-	Destination string
-	Context     context.Context
+	Event         string
+	Payload       any
+	Transition    string
+	Source        string
+	Destination   string
+	State         string
+	Context       context.Context
+	Replay        bool // when set, Payload is the journaled json.RawMessage rather than the value originally passed
+	compensations *[]Compensation
+}
+
+type Compensation func(ctx context.Context) error
+
+func (s Scope) Compensate(compensation Compensation) {
+	if s.compensations == nil {
+		return
+	}
+
+	*s.compensations = append(*s.compensations, compensation)
+}
+
+func (s Scope) withTransition(transition *Transition) Scope {
+	s.Transition = transition.Name()
+	s.Source = transition.source.Name()
+	s.Destination = transition.destination.Name()
+
+	return s
 }
 
 type Callback func(scope Scope) (context.Context, error)
@@ -27,19 +50,3 @@ func NewCallbacks(
 
 	return &c
 }
-
-func (c *Callbacks) enter(scope Scope) (context.Context, error) {
-	if c.enterCallback == nil {
-		return scope.Context, nil
-	}
-
-	return c.enterCallback(scope)
-}
-
-func (c *Callbacks) exit(scope Scope) (context.Context, error) {
-	if c.exitCallback == nil {
-		return scope.Context, nil
-	}
-
-	return c.exitCallback(scope)
-}
@@ -0,0 +1,30 @@
+package fsm
+
+import "time"
+
+// an alias so fake clocks (e.g. fsmtest) needn't import this package, which would stop its own tests using them
+type Timer = interface {
+	Stop() bool
+}
+
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type realClock struct{}
+
+func (c realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func WithClock(clock Clock) MachineOption {
+	return func(m *Machine) error {
+		m.clock = clock
+		return nil
+	}
+}
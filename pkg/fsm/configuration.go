@@ -0,0 +1,155 @@
+package fsm
+
+import "sort"
+
+type stateSet map[*State]bool
+
+func (m *Machine) sortedStates(states stateSet) []*State {
+	sorted := make([]*State, 0, len(states))
+	for state := range states {
+		sorted = append(sorted, state)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return m.orderByState[sorted[i]] < m.orderByState[sorted[j]]
+	})
+
+	return sorted
+}
+
+func (m *Machine) leaves() []*State {
+	leaves := make([]*State, 0)
+	for _, state := range m.sortedStates(m.active) {
+		if len(state.children) == 0 {
+			leaves = append(leaves, state)
+		}
+	}
+
+	return leaves
+}
+
+func (s stateSet) containsDescendantOf(ancestor *State) bool {
+	for state := range s {
+		if state == ancestor || state.isDescendantOf(ancestor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s stateSet) intersects(other stateSet) bool {
+	for state := range other {
+		if s[state] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Machine) exitSet(transition *Transition) stateSet {
+	exited := make(stateSet)
+
+	if transition.source == transition.destination {
+		return exited
+	}
+
+	domain := lowestCommonCompoundAncestor(transition.source, transition.destination)
+
+	for state := range m.active {
+		if domain == nil || state.isDescendantOf(domain) {
+			exited[state] = true
+		}
+	}
+
+	return exited
+}
+
+func (m *Machine) entrySet(transition *Transition) stateSet {
+	entered := make(stateSet)
+
+	if transition.source == transition.destination {
+		return entered
+	}
+
+	domain := lowestCommonCompoundAncestor(transition.source, transition.destination)
+
+	m.addDescendantsToEnter(transition.destination, entered)
+	m.addAncestorsToEnter(transition.destination, domain, entered)
+
+	return entered
+}
+
+func (m *Machine) addDescendantsToEnter(state *State, entered stateSet) {
+	if state.history != NoHistory {
+		parent := state.parent
+
+		leaves, ok := m.historyByState[parent]
+		if !ok {
+			m.addDefaultChildrenToEnter(parent, entered)
+			return
+		}
+
+		targets := make([]*State, 0, len(leaves))
+
+		for _, leaf := range leaves {
+			target := leaf
+
+			if state.history == ShallowHistory {
+				for target.parent != parent {
+					target = target.parent
+				}
+			}
+
+			m.addDescendantsToEnter(target, entered)
+
+			for ancestor := target.parent; ancestor != parent; ancestor = ancestor.parent {
+				entered[ancestor] = true
+			}
+
+			targets = append(targets, target)
+		}
+
+		// regions are only given their defaults once every recorded leaf has been added
+		for _, target := range targets {
+			m.addAncestorsToEnter(target, parent, entered)
+		}
+
+		return
+	}
+
+	entered[state] = true
+
+	m.addDefaultChildrenToEnter(state, entered)
+}
+
+func (m *Machine) addDefaultChildrenToEnter(state *State, entered stateSet) {
+	if state.parallel {
+		for _, child := range state.children {
+			if !entered.containsDescendantOf(child) {
+				m.addDescendantsToEnter(child, entered)
+			}
+		}
+
+		return
+	}
+
+	if state.initialChild != nil {
+		m.addDescendantsToEnter(state.initialChild, entered)
+	}
+}
+
+func (m *Machine) addAncestorsToEnter(state *State, domain *State, entered stateSet) {
+	for ancestor := state.parent; ancestor != nil && ancestor != domain; ancestor = ancestor.parent {
+		entered[ancestor] = true
+
+		if ancestor.parallel {
+			for _, child := range ancestor.children {
+				if !entered.containsDescendantOf(child) {
+					m.addDescendantsToEnter(child, entered)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package fsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"time"
+)
+
+const (
+	shallowHistoryDefinition = "shallow"
+	deepHistoryDefinition    = "deep"
+)
+
+type TimeoutDefinition struct {
+	After      string `json:"after" yaml:"after"`
+	Transition string `json:"transition" yaml:"transition"`
+}
+
+type StateDefinition struct {
+	Name     string              `json:"name" yaml:"name"`
+	OnEnter  string              `json:"on_enter,omitempty" yaml:"on_enter,omitempty"`
+	OnExit   string              `json:"on_exit,omitempty" yaml:"on_exit,omitempty"`
+	Initial  string              `json:"initial,omitempty" yaml:"initial,omitempty"`
+	Parallel bool                `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	History  string              `json:"history,omitempty" yaml:"history,omitempty"`
+	Timeouts []TimeoutDefinition `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+	States   []StateDefinition   `json:"states,omitempty" yaml:"states,omitempty"`
+}
+
+type TransitionDefinition struct {
+	Name        string `json:"name" yaml:"name"`
+	Source      string `json:"source" yaml:"source"`
+	Destination string `json:"destination" yaml:"destination"`
+	Event       string `json:"event,omitempty" yaml:"event,omitempty"`
+	Guard       string `json:"guard,omitempty" yaml:"guard,omitempty"`
+	OnEnter     string `json:"on_enter,omitempty" yaml:"on_enter,omitempty"`
+	OnExit      string `json:"on_exit,omitempty" yaml:"on_exit,omitempty"`
+}
+
+type Definition struct {
+	Initial     string                 `json:"initial" yaml:"initial"`
+	States      []StateDefinition      `json:"states" yaml:"states"`
+	Transitions []TransitionDefinition `json:"transitions,omitempty" yaml:"transitions,omitempty"`
+}
+
+func UnmarshalDefinition(data []byte) (Definition, error) {
+	definition := Definition{}
+
+	// JSON is a subset of YAML so one decoder handles both
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(&definition)
+	if err != nil {
+		return definition, errorf(ErrInvalidDefinition, "failed to unmarshal definition: %v", err)
+	}
+
+	return definition, nil
+}
+
+type definitionBuilder struct {
+	registry    *Registry
+	stateByName map[string]*State
+	eventByName map[string]*Event
+	unresolved  []error
+}
+
+func (b *definitionBuilder) callback(name string, usage string) Callback {
+	if name == "" {
+		return nil
+	}
+
+	if b.registry != nil {
+		callback, ok := b.registry.GetCallback(name)
+		if ok {
+			return callback
+		}
+	}
+
+	b.unresolved = append(b.unresolved, errorf(ErrUnresolvedReference, "callback %#+v for %v not registered", name, usage))
+
+	return nil
+}
+
+func (b *definitionBuilder) guard(name string, usage string) Guard {
+	if name == "" {
+		return nil
+	}
+
+	if b.registry != nil {
+		guard, ok := b.registry.GetGuard(name)
+		if ok {
+			return guard
+		}
+	}
+
+	b.unresolved = append(b.unresolved, errorf(ErrUnresolvedReference, "guard %#+v for %v not registered", name, usage))
+
+	return nil
+}
+
+func (b *definitionBuilder) state(definition StateDefinition, parent *State) (*State, error) {
+	if definition.Name == "" {
+		return nil, errorf(ErrInvalidDefinition, "state name must not be empty")
+	}
+
+	_, ok := b.stateByName[definition.Name]
+	if ok {
+		return nil, errorf(ErrDuplicateState, "state %#+v already exists", definition.Name)
+	}
+
+	if definition.History != "" {
+		if parent == nil {
+			return nil, errorf(ErrInvalidDefinition, "history state %#+v has no parent", definition.Name)
+		}
+
+		if len(definition.States) > 0 || len(definition.Timeouts) > 0 || definition.OnEnter != "" || definition.OnExit != "" {
+			return nil, errorf(
+				ErrInvalidDefinition,
+				"history state %#+v must not have states, timeouts or callbacks",
+				definition.Name,
+			)
+		}
+
+		var state *State
+
+		switch definition.History {
+		case shallowHistoryDefinition:
+			state = NewShallowHistory(definition.Name, parent)
+		case deepHistoryDefinition:
+			state = NewDeepHistory(definition.Name, parent)
+		default:
+			return nil, errorf(
+				ErrInvalidDefinition,
+				"state %#+v history %#+v not one of %#+v or %#+v",
+				definition.Name, definition.History, shallowHistoryDefinition, deepHistoryDefinition,
+			)
+		}
+
+		b.stateByName[definition.Name] = state
+
+		return state, nil
+	}
+
+	usage := fmt.Sprintf("state %#+v", definition.Name)
+
+	opts := make([]StateOption, 0)
+
+	for _, timeoutDefinition := range definition.Timeouts {
+		duration, err := time.ParseDuration(timeoutDefinition.After)
+		if err != nil {
+			return nil, errorf(
+				ErrInvalidDefinition,
+				"state %#+v timeout %#+v not a duration: %v",
+				definition.Name, timeoutDefinition.After, err,
+			)
+		}
+
+		opts = append(opts, WithTimeout(duration, timeoutDefinition.Transition))
+	}
+
+	state := NewState(
+		definition.Name,
+		b.callback(definition.OnEnter, usage+" on_enter"),
+		b.callback(definition.OnExit, usage+" on_exit"),
+		opts...,
+	)
+
+	b.stateByName[definition.Name] = state
+
+	children := make([]*State, 0)
+
+	// histories are attached to their parent as they are built, so they are left out of the children
+	for _, childDefinition := range definition.States {
+		if childDefinition.History != "" {
+			continue
+		}
+
+		child, err := b.state(childDefinition, state)
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, child)
+	}
+
+	if definition.Parallel {
+		WithRegions(children...)(state)
+	} else if len(children) > 0 {
+		WithChildren(children...)(state)
+	}
+
+	for _, childDefinition := range definition.States {
+		if childDefinition.History == "" {
+			continue
+		}
+
+		_, err := b.state(childDefinition, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if definition.Initial != "" {
+		if definition.Parallel {
+			return nil, errorf(ErrInvalidDefinition, "parallel state %#+v must not have an initial state", definition.Name)
+		}
+
+		initialChild, ok := b.stateByName[definition.Initial]
+		if !ok || initialChild.parent != state || initialChild.history != NoHistory {
+			return nil, errorf(
+				ErrInvalidDefinition,
+				"initial state %#+v not a child of state %#+v",
+				definition.Initial, definition.Name,
+			)
+		}
+
+		WithInitialChild(initialChild)(state)
+	}
+
+	return state, nil
+}
+
+func NewMachineFromDefinition(
+	definition Definition,
+	registry *Registry,
+	opts ...MachineOption,
+) (*Machine, error) {
+	b := definitionBuilder{
+		registry:    registry,
+		stateByName: make(map[string]*State),
+		eventByName: make(map[string]*Event),
+	}
+
+	states := make([]*State, 0)
+	for _, stateDefinition := range definition.States {
+		state, err := b.state(stateDefinition, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, state)
+	}
+
+	transitions := make([]*Transition, 0)
+	for _, transitionDefinition := range definition.Transitions {
+		source, ok := b.stateByName[transitionDefinition.Source]
+		if !ok {
+			return nil, errorf(
+				ErrUnknownState,
+				"transition %#+v source %#+v not in states",
+				transitionDefinition.Name, transitionDefinition.Source,
+			)
+		}
+
+		destination, ok := b.stateByName[transitionDefinition.Destination]
+		if !ok {
+			return nil, errorf(
+				ErrUnknownState,
+				"transition %#+v destination %#+v not in states",
+				transitionDefinition.Name, transitionDefinition.Destination,
+			)
+		}
+
+		usage := fmt.Sprintf("transition %#+v", transitionDefinition.Name)
+
+		transitionOpts := make([]TransitionOption, 0)
+
+		guard := b.guard(transitionDefinition.Guard, usage)
+		if guard != nil {
+			transitionOpts = append(transitionOpts, WithGuard(guard))
+		}
+
+		if transitionDefinition.Event != "" {
+			event, ok := b.eventByName[transitionDefinition.Event]
+			if !ok {
+				event = NewEvent(transitionDefinition.Event)
+				b.eventByName[transitionDefinition.Event] = event
+			}
+
+			transitionOpts = append(transitionOpts, WithEvent(event))
+		}
+
+		transitions = append(transitions, NewTransition(
+			transitionDefinition.Name,
+			source,
+			destination,
+			b.callback(transitionDefinition.OnEnter, usage+" on_enter"),
+			b.callback(transitionDefinition.OnExit, usage+" on_exit"),
+			transitionOpts...,
+		))
+	}
+
+	if len(b.unresolved) > 0 {
+		return nil, errors.Join(b.unresolved...)
+	}
+
+	initialState, ok := b.stateByName[definition.Initial]
+	if !ok {
+		return nil, errorf(ErrUnknownState, "initial state %#+v not in states", definition.Initial)
+	}
+
+	return NewMachine(states, transitions, initialState, opts...)
+}
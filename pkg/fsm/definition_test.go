@@ -0,0 +1,181 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"github.com/initialed85/stato/pkg/fsm/fsmtest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const connectorDefinitionYAML = `
+initial: available
+states:
+  - name: available
+    on_enter: log
+  - name: occupied
+    initial: preparing
+    states:
+      - name: preparing
+        on_enter: log
+        timeouts:
+          - after: 2m
+            transition: expire
+      - name: charging
+        on_enter: log
+      - name: occupied_history
+        history: shallow
+  - name: faulted
+transitions:
+  - name: plug_in
+    source: available
+    destination: preparing
+  - name: remote_start
+    source: preparing
+    destination: charging
+    event: remote_start
+    guard: no_transaction
+    on_enter: start_transaction
+  - name: expire
+    source: preparing
+    destination: available
+    event: expire
+  - name: fault
+    source: occupied
+    destination: faulted
+  - name: resume
+    source: faulted
+    destination: occupied_history
+`
+
+const connectorDefinitionJSON = `{
+  "initial": "available",
+  "states": [
+    {"name": "available", "on_enter": "log"},
+    {
+      "name": "occupied",
+      "initial": "preparing",
+      "states": [
+        {"name": "preparing", "on_enter": "log", "timeouts": [{"after": "2m", "transition": "expire"}]},
+        {"name": "charging", "on_enter": "log"},
+        {"name": "occupied_history", "history": "shallow"}
+      ]
+    },
+    {"name": "faulted"}
+  ],
+  "transitions": [
+    {"name": "plug_in", "source": "available", "destination": "preparing"},
+    {
+      "name": "remote_start",
+      "source": "preparing",
+      "destination": "charging",
+      "event": "remote_start",
+      "guard": "no_transaction",
+      "on_enter": "start_transaction"
+    },
+    {"name": "expire", "source": "preparing", "destination": "available", "event": "expire"},
+    {"name": "fault", "source": "occupied", "destination": "faulted"},
+    {"name": "resume", "source": "faulted", "destination": "occupied_history"}
+  ]
+}`
+
+func TestDefinition(t *testing.T) {
+	for _, data := range []string{connectorDefinitionYAML, connectorDefinitionJSON} {
+		clock := fsmtest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		entered := make([]string, 0)
+		transaction := false
+
+		registry := NewRegistry()
+
+		err := registry.RegisterCallback("log", func(scope Scope) (context.Context, error) {
+			entered = append(entered, scope.State)
+			return scope.Context, nil
+		})
+		require.NoError(t, err)
+
+		err = registry.RegisterCallback("start_transaction", func(scope Scope) (context.Context, error) {
+			transaction = true
+			return scope.Context, nil
+		})
+		require.NoError(t, err)
+
+		err = registry.RegisterGuard("no_transaction", func(scope Scope) bool {
+			return !transaction
+		})
+		require.NoError(t, err)
+
+		err = registry.RegisterGuard("no_transaction", func(scope Scope) bool {
+			return true
+		})
+		require.ErrorIs(t, err, ErrInvalidDefinition)
+
+		definition, err := UnmarshalDefinition([]byte(data))
+		require.NoError(t, err)
+
+		m, err := NewMachineFromDefinition(definition, registry, WithClock(clock))
+		require.NoError(t, err)
+		require.Equal(t, "available", m.State())
+
+		_, err = m.Transition("plug_in", context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "preparing", m.State())
+
+		clock.Advance(time.Minute * 2)
+		require.Equal(t, "available", m.State())
+
+		_, err = m.Transition("plug_in", context.Background())
+		require.NoError(t, err)
+
+		_, err = m.Fire(context.Background(), "remote_start", nil)
+		require.NoError(t, err)
+		require.Equal(t, "charging", m.State())
+		require.True(t, transaction)
+
+		_, err = m.Transition("fault", context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "faulted", m.State())
+
+		_, err = m.Transition("resume", context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "charging", m.State())
+
+		require.Equal(t, []string{"preparing", "available", "preparing", "charging", "charging"}, entered)
+	}
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	_, err := UnmarshalDefinition([]byte("initial: a\nstates: [{name: a, colour: blue}]\n"))
+	require.ErrorIs(t, err, ErrInvalidDefinition)
+
+	definition, err := UnmarshalDefinition([]byte(connectorDefinitionYAML))
+	require.NoError(t, err)
+
+	_, err = NewMachineFromDefinition(definition, NewRegistry())
+	require.ErrorIs(t, err, ErrUnresolvedReference)
+	require.Contains(t, err.Error(), `callback "log" for state "available" on_enter not registered`)
+	require.Contains(t, err.Error(), `guard "no_transaction" for transition "remote_start" not registered`)
+	require.Contains(t, err.Error(), `callback "start_transaction" for transition "remote_start" on_enter not registered`)
+
+	for _, data := range []string{
+		"initial: b\nstates: [{name: a}]\n",
+		"initial: a\nstates: [{name: a}, {name: a}]\n",
+		"initial: a\nstates: [{name: a, history: shallow}]\n",
+		"initial: a\nstates: [{name: a, states: [{name: b, history: wide}]}]\n",
+		"initial: a\nstates: [{name: a, initial: c, states: [{name: b}]}]\n",
+		"initial: a\nstates: [{name: a, timeouts: [{after: soon, transition: t}]}]\n",
+		"initial: a\nstates: [{name: a}]\ntransitions: [{name: t, source: a, destination: b}]\n",
+	} {
+		definition, err := UnmarshalDefinition([]byte(data))
+		require.NoError(t, err)
+
+		_, err = NewMachineFromDefinition(definition, nil)
+		require.Error(t, err)
+		require.True(
+			t,
+			errors.Is(err, ErrInvalidDefinition) || errors.Is(err, ErrUnknownState) || errors.Is(err, ErrDuplicateState),
+			err.Error(),
+		)
+	}
+}
@@ -0,0 +1,286 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const defaultMaxQueueDepth = 64
+
+func WithMaxQueueDepth(maxQueueDepth int) MachineOption {
+	return func(m *Machine) error {
+		if maxQueueDepth < 1 {
+			return errorf(ErrInvalidOption, "max queue depth %#+v less than 1", maxQueueDepth)
+		}
+
+		m.maxQueueDepth = maxQueueDepth
+
+		return nil
+	}
+}
+
+type requestKind int
+
+const (
+	transitionRequest requestKind = iota
+	fireRequest
+	changeStateRequest
+	timeoutRequest
+)
+
+type request struct {
+	kind    requestKind
+	name    string
+	payload any
+	timer   *pendingTimer
+	ctx     context.Context
+}
+
+func (r request) String() string {
+	switch r.kind {
+	case fireRequest:
+		return fmt.Sprintf("event %#+v", r.name)
+	case changeStateRequest:
+		return fmt.Sprintf("change to state %#+v", r.name)
+	case timeoutRequest:
+		return fmt.Sprintf("timeout of state %#+v", r.timer.state.Name())
+	default:
+		return fmt.Sprintf("transition %#+v", r.name)
+	}
+}
+
+// QueuedRequestError is returned alongside the context of a request that committed when requests queued by its
+// callbacks then failed
+type QueuedRequestError struct {
+	Errs []error
+}
+
+func (e *QueuedRequestError) Error() string {
+	messages := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%v queued requests failed: %v", len(e.Errs), strings.Join(messages, "; "))
+}
+
+func (e *QueuedRequestError) Unwrap() []error {
+	return e.Errs
+}
+
+type dispatcherKey struct{}
+
+type dispatcher struct {
+	machine *Machine
+	mu      sync.Mutex
+	active  bool
+	queue   []request
+}
+
+func newDispatcher(machine *Machine) *dispatcher {
+	d := dispatcher{
+		machine: machine,
+		active:  true,
+	}
+
+	return &d
+}
+
+// enqueue reports false once the dispatcher has finished, so the request can be handled on its own instead
+func (d *dispatcher) enqueue(r request) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active {
+		return false, nil
+	}
+
+	if len(d.queue) >= d.machine.maxQueueDepth {
+		return false, errorf(
+			ErrQueueFull,
+			"queue depth %v exceeded queueing %v",
+			d.machine.maxQueueDepth, r,
+		)
+	}
+
+	d.queue = append(d.queue, r)
+
+	return true, nil
+}
+
+// dequeue finishes the dispatcher as it finds the queue empty, so nothing can be queued behind the last request
+func (d *dispatcher) dequeue() (request, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.queue) == 0 {
+		d.active = false
+		return request{}, false
+	}
+
+	r := d.queue[0]
+	d.queue = d.queue[1:]
+
+	return r, true
+}
+
+func (d *dispatcher) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active = false
+	d.queue = nil
+}
+
+// enqueue queues r behind the request whose callbacks ctx came from, if that request is still being handled
+func (m *Machine) enqueue(ctx context.Context, r request) (bool, error) {
+	d, ok := ctx.Value(dispatcherKey{}).(*dispatcher)
+	if !ok || d.machine != m {
+		return false, nil
+	}
+
+	r.ctx = ctx
+
+	return d.enqueue(r)
+}
+
+func (m *Machine) dispatch(ctx context.Context, r request) (context.Context, error) {
+	// a request from inside a callback is queued and run once the current one completes; this relies on the callback
+	// passing scope.Context through, as any other context blocks on m.mu
+	queued, err := m.enqueue(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if queued {
+		return ctx, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := newDispatcher(m)
+	defer d.finish()
+
+	r.ctx = context.WithValue(ctx, dispatcherKey{}, d)
+
+	ctx, err = m.handle(r)
+	if err != nil {
+		return nil, err
+	}
+
+	queuedErrs := make([]error, 0)
+
+	for handled := 0; ; handled++ {
+		queued, ok := d.dequeue()
+		if !ok {
+			break
+		}
+
+		if handled >= m.maxQueueDepth {
+			queuedErrs = append(queuedErrs, errorf(
+				ErrLoopDetected,
+				"more than %v queued requests handled, possible loop at %v",
+				m.maxQueueDepth, queued,
+			))
+			break
+		}
+
+		_, err = m.handle(queued)
+		if err != nil {
+			queuedErrs = append(queuedErrs, fmt.Errorf("queued %v failed: %w", queued, err))
+		}
+	}
+
+	if len(queuedErrs) > 0 {
+		return ctx, &QueuedRequestError{Errs: queuedErrs}
+	}
+
+	return ctx, nil
+}
+
+func (r request) scope() Scope {
+	scope := Scope{
+		Payload: r.payload,
+		Context: r.ctx,
+	}
+
+	switch r.kind {
+	case fireRequest:
+		scope.Event = r.name
+	case changeStateRequest:
+		scope.Destination = r.name
+	case timeoutRequest:
+		scope.Transition = r.timer.timeout.transition
+		scope.State = r.timer.state.Name()
+	default:
+		scope.Transition = r.name
+	}
+
+	return scope
+}
+
+func (m *Machine) handle(r request) (context.Context, error) {
+	if m.journal == nil {
+		return m.handleAndNotify(r)
+	}
+
+	entry, err := r.journalEntry(m.State())
+	if err != nil {
+		return nil, err
+	}
+
+	m.pendingEntry = &entry
+	m.journaled = false
+	defer func() {
+		m.pendingEntry = nil
+	}()
+
+	// successful attempts are appended by transition before they commit
+	ctx, err := m.handleAndNotify(r)
+	if err != nil {
+		entry.Timestamp = m.clock.Now()
+		entry.Version = m.version
+		entry.Error = err.Error()
+		entry.Aborted = m.journaled
+
+		journalErr := m.journal.Append(r.ctx, entry)
+		if journalErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to append journal entry: %w", journalErr))
+		}
+
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+func (m *Machine) handleAndNotify(r request) (context.Context, error) {
+	m.attempted = false
+
+	ctx, err := m.handleRequest(r)
+	if err != nil && !m.attempted {
+		// failures from within a transition have already been notified with the full scope
+		m.listeners.each(func(listener Listener) {
+			listener.TransitionFailed(r.scope(), err)
+		})
+	}
+
+	return ctx, err
+}
+
+func (m *Machine) handleRequest(r request) (context.Context, error) {
+	switch r.kind {
+	case fireRequest:
+		return m.handleFire(r.ctx, r.name, r.payload)
+	case changeStateRequest:
+		return m.handleChangeState(r.ctx, r.name)
+	case timeoutRequest:
+		return m.handleTimeout(r.ctx, r.timer)
+	default:
+		return m.handleTransition(r.ctx, r.name)
+	}
+}
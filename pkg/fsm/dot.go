@@ -0,0 +1,126 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ExportDOT(m *Machine, opts ...ExportOption) string {
+	o := newExportOptions(opts)
+
+	current := make(stateSet)
+	if o.currentState {
+		current = m.currentStates()
+	}
+
+	b := new(strings.Builder)
+
+	fmt.Fprintf(b, "digraph %v {\n", quote(o.name))
+	b.WriteString("\tcompound=true;\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=rounded];\n")
+	b.WriteString("\n")
+	b.WriteString("\t\"__initial\" [shape=point, width=0.2];\n")
+
+	for _, state := range m.topLevelStates() {
+		writeDOTState(b, m, state, current, "\t")
+	}
+
+	b.WriteString("\n")
+	fmt.Fprintf(b, "\t\"__initial\" -> %v;\n", dotTarget(m.initialState))
+
+	for _, state := range m.States() {
+		if state.initialChild != nil {
+			fmt.Fprintf(
+				b,
+				"\t%v -> %v;\n",
+				quote("__initial_"+state.Name()), dotTarget(state.initialChild),
+			)
+		}
+	}
+
+	for _, transition := range m.transitions {
+		attributes := []string{"label=" + quote(transitionLabel(transition))}
+
+		// edges to and from a composite state are clipped to its cluster, self-transitions stay loops on the anchor
+		if transition.source != transition.destination {
+			if len(transition.source.children) > 0 {
+				attributes = append(attributes, "ltail="+quote("cluster_"+transition.source.Name()))
+			}
+
+			if len(transition.destination.children) > 0 {
+				attributes = append(attributes, "lhead="+quote("cluster_"+transition.destination.Name()))
+			}
+		}
+
+		fmt.Fprintf(
+			b,
+			"\t%v -> %v [%v];\n",
+			dotTarget(transition.source), dotTarget(transition.destination), strings.Join(attributes, ", "),
+		)
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func dotTarget(state *State) string {
+	if len(state.children) > 0 {
+		return quote("__anchor_" + state.Name())
+	}
+
+	return quote(state.Name())
+}
+
+func writeDOTState(b *strings.Builder, m *Machine, state *State, current stateSet, indent string) {
+	if state.history != NoHistory {
+		fmt.Fprintf(b, "%v%v [shape=circle, label=%v];\n", indent, quote(state.Name()), quote(historyLabel(state)))
+		return
+	}
+
+	if len(state.children) == 0 {
+		attributes := make([]string, 0)
+
+		if state == m.initialState {
+			attributes = append(attributes, "peripheries=2")
+		}
+
+		if current[state] {
+			attributes = append(attributes, `style="rounded,filled"`, `fillcolor="lightblue"`)
+		}
+
+		if len(attributes) == 0 {
+			fmt.Fprintf(b, "%v%v;\n", indent, quote(state.Name()))
+		} else {
+			fmt.Fprintf(b, "%v%v [%v];\n", indent, quote(state.Name()), strings.Join(attributes, ", "))
+		}
+
+		return
+	}
+
+	fmt.Fprintf(b, "%vsubgraph %v {\n", indent, quote("cluster_"+state.Name()))
+	fmt.Fprintf(b, "%v\tlabel=%v;\n", indent, quote(state.Name()))
+
+	if state.parallel {
+		fmt.Fprintf(b, "%v\tstyle=dashed;\n", indent)
+	} else {
+		fmt.Fprintf(b, "%v\tstyle=rounded;\n", indent)
+	}
+
+	if state == m.initialState {
+		fmt.Fprintf(b, "%v\tpenwidth=2;\n", indent)
+	}
+
+	fmt.Fprintf(b, "%v\t%v [shape=point, style=invis];\n", indent, quote("__anchor_"+state.Name()))
+
+	if state.initialChild != nil {
+		fmt.Fprintf(b, "%v\t%v [shape=point, width=0.2];\n", indent, quote("__initial_"+state.Name()))
+	}
+
+	for _, child := range diagramChildren(state) {
+		writeDOTState(b, m, child, current, indent+"\t")
+	}
+
+	fmt.Fprintf(b, "%v}\n", indent)
+}
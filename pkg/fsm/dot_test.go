@@ -0,0 +1,82 @@
+package fsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newDiagramMachine(t *testing.T) *Machine {
+	stateA := NewState("state_a", nil, nil)
+	stateB1 := NewState("state_b_1", nil, nil)
+	stateB2 := NewState("state_b_2", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1, stateB2))
+	stateBHistory := NewShallowHistory("state_b_history", stateB)
+	stateC := NewState("state_c", nil, nil)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil, WithEvent(NewEvent("start"))),
+			NewTransition("transition_a_a", stateA, stateA, nil, nil),
+			NewTransition("transition_b_next", stateB1, stateB2, nil, nil),
+			NewTransition(
+				"transition_b_c",
+				stateB,
+				stateC,
+				nil,
+				nil,
+				WithGuard(func(scope Scope) bool {
+					return true
+				}),
+			),
+			NewTransition("transition_c_b", stateC, stateBHistory, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Fire(context.Background(), "start", nil)
+	require.NoError(t, err)
+
+	return m
+}
+
+func TestExportDOT(t *testing.T) {
+	m := newDiagramMachine(t)
+
+	require.Equal(
+		t,
+		`digraph "fsm" {
+	compound=true;
+	rankdir=LR;
+	node [shape=box, style=rounded];
+
+	"__initial" [shape=point, width=0.2];
+	"state_a" [peripheries=2];
+	subgraph "cluster_state_b" {
+		label="state_b";
+		style=rounded;
+		"__anchor_state_b" [shape=point, style=invis];
+		"__initial_state_b" [shape=point, width=0.2];
+		"state_b_1" [style="rounded,filled", fillcolor="lightblue"];
+		"state_b_2";
+		"state_b_history" [shape=circle, label="H"];
+	}
+	"state_c";
+
+	"__initial" -> "state_a";
+	"__initial_state_b" -> "state_b_1";
+	"state_a" -> "__anchor_state_b" [label="transition_a_b (start)", lhead="cluster_state_b"];
+	"state_a" -> "state_a" [label="transition_a_a"];
+	"state_b_1" -> "state_b_2" [label="transition_b_next"];
+	"__anchor_state_b" -> "state_c" [label="transition_b_c [guarded]", ltail="cluster_state_b"];
+	"state_c" -> "state_b_history" [label="transition_c_b"];
+}
+`,
+		ExportDOT(m),
+	)
+
+	require.Contains(t, ExportDOT(m, WithDiagramName("connector"), WithCurrentState(false)), `digraph "connector" {`)
+	require.NotContains(t, ExportDOT(m, WithCurrentState(false)), "lightblue")
+}
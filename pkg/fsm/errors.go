@@ -0,0 +1,104 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidDefinition   = errors.New("invalid definition")
+	ErrInvalidOption       = errors.New("invalid option")
+	ErrDuplicateState      = errors.New("duplicate state")
+	ErrDuplicateTransition = errors.New("duplicate transition")
+	ErrDuplicateEvent      = errors.New("duplicate event")
+	ErrUnknownState        = errors.New("unknown state")
+	ErrUnknownTransition   = errors.New("unknown transition")
+	ErrUnknownEvent        = errors.New("unknown event")
+	ErrInvalidTransition   = errors.New("invalid transition")
+	ErrAmbiguousTransition = errors.New("ambiguous transition")
+	ErrGuardRejected       = errors.New("guard rejected")
+	ErrQueueFull           = errors.New("queue full")
+	ErrLoopDetected        = errors.New("loop detected")
+	ErrStopped             = errors.New("stopped")
+	ErrInvalidSnapshot     = errors.New("invalid snapshot")
+	ErrSnapshotNotFound    = errors.New("snapshot not found")
+	ErrVersionConflict     = errors.New("version conflict")
+	ErrReplayDiverged      = errors.New("replay diverged")
+	ErrUnresolvedReference = errors.New("unresolved reference")
+)
+
+// sentinelError keeps the descriptive message while still matching the sentinel with errors.Is
+type sentinelError struct {
+	message  string
+	sentinel error
+}
+
+func (e *sentinelError) Error() string {
+	return e.message
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.sentinel
+}
+
+func errorf(sentinel error, format string, a ...any) error {
+	return &sentinelError{
+		message:  fmt.Sprintf(format, a...),
+		sentinel: sentinel,
+	}
+}
+
+type Phase string
+
+const (
+	TransitionEnterPhase Phase = "transition enter"
+	StateExitPhase       Phase = "state exit"
+	StateEnterPhase      Phase = "state enter"
+	TransitionExitPhase  Phase = "transition exit"
+	SavePhase            Phase = "save"
+	JournalPhase         Phase = "journal"
+)
+
+type TransitionError struct {
+	Phase       Phase
+	Transition  string
+	Source      string
+	Destination string
+	State       string
+	Err         error
+}
+
+func (e *TransitionError) Error() string {
+	message := fmt.Sprintf("%v failed", e.Phase)
+
+	if e.State != "" {
+		message += fmt.Sprintf(" for state %#+v", e.State)
+	}
+
+	message += fmt.Sprintf(
+		" during transition %#+v from %#+v to %#+v: %v",
+		e.Transition, e.Source, e.Destination, e.Err,
+	)
+
+	return message
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+func newTransitionError(phase Phase, transition *Transition, state *State, err error) error {
+	e := TransitionError{
+		Phase:       phase,
+		Transition:  transition.Name(),
+		Source:      transition.source.Name(),
+		Destination: transition.destination.Name(),
+		Err:         err,
+	}
+
+	if state != nil {
+		e.State = state.Name()
+	}
+
+	return &e
+}
@@ -0,0 +1,115 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errFailed := fmt.Errorf("failed")
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			return nil, errFailed
+		},
+		nil,
+	)
+	stateC := NewState("state_c", nil, nil)
+
+	transitionAB := NewTransition("transition_a_b", stateA, stateB, nil, nil)
+	transitionAC := NewTransition(
+		"transition_a_c",
+		stateA,
+		stateC,
+		nil,
+		nil,
+		WithGuard(func(scope Scope) bool {
+			return false
+		}),
+	)
+	transitionCA := NewTransition("transition_c_a", stateC, stateA, nil, nil)
+
+	for _, testCase := range []struct {
+		states      []*State
+		transitions []*Transition
+		opts        []MachineOption
+		err         error
+	}{
+		{
+			states: []*State{stateA, NewState("state_a", nil, nil)},
+			err:    ErrDuplicateState,
+		},
+		{
+			states:      []*State{stateA, stateB},
+			transitions: []*Transition{transitionAB, NewTransition("transition_a_b", stateA, stateB, nil, nil)},
+			err:         ErrDuplicateTransition,
+		},
+		{
+			states:      []*State{stateA},
+			transitions: []*Transition{transitionAB},
+			err:         ErrUnknownState,
+		},
+		{
+			states: []*State{stateA},
+			opts:   []MachineOption{WithMaxQueueDepth(0)},
+			err:    ErrInvalidOption,
+		},
+		{
+			states: []*State{stateA},
+			opts:   []MachineOption{WithRestoredState(Snapshot{Configuration: []string{"state_d"}})},
+			err:    ErrInvalidSnapshot,
+		},
+	} {
+		_, err := NewMachine(testCase.states, testCase.transitions, stateA, testCase.opts...)
+		require.ErrorIs(t, err, testCase.err)
+	}
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{transitionAB, transitionAC, transitionCA},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_d", context.Background())
+	require.ErrorIs(t, err, ErrUnknownTransition)
+
+	_, err = m.Fire(context.Background(), "event_d", nil)
+	require.ErrorIs(t, err, ErrUnknownEvent)
+
+	_, err = m.ChangeState(context.Background(), "state_d")
+	require.ErrorIs(t, err, ErrUnknownState)
+
+	_, err = m.Transition("transition_c_a", context.Background())
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	_, err = m.Transition("transition_a_c", context.Background())
+	require.ErrorIs(t, err, ErrGuardRejected)
+
+	guardRejectedError := &GuardRejectedError{}
+	require.True(t, errors.As(err, &guardRejectedError))
+	require.Equal(t, "state_c", guardRejectedError.Destination)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.ErrorIs(t, err, errFailed)
+
+	transitionError := &TransitionError{}
+	require.True(t, errors.As(err, &transitionError))
+	require.Equal(
+		t,
+		TransitionError{
+			Phase:       StateEnterPhase,
+			Transition:  "transition_a_b",
+			Source:      "state_a",
+			Destination: "state_b",
+			State:       "state_b",
+			Err:         errFailed,
+		},
+		*transitionError,
+	)
+}
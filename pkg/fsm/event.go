@@ -0,0 +1,15 @@
+package fsm
+
+type Event struct {
+	*Named
+}
+
+func NewEvent(
+	name string,
+) *Event {
+	e := Event{
+		Named: NewNamed(name),
+	}
+
+	return &e
+}
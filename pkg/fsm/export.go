@@ -0,0 +1,94 @@
+package fsm
+
+import (
+	"regexp"
+	"strings"
+)
+
+var nonIdentifierPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+type ExportOption func(o *exportOptions)
+
+type exportOptions struct {
+	name         string
+	currentState bool
+}
+
+func WithDiagramName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.name = name
+	}
+}
+
+func WithCurrentState(currentState bool) ExportOption {
+	return func(o *exportOptions) {
+		o.currentState = currentState
+	}
+}
+
+func newExportOptions(opts []ExportOption) exportOptions {
+	o := exportOptions{
+		name:         "fsm",
+		currentState: true,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+func (m *Machine) topLevelStates() []*State {
+	states := make([]*State, 0)
+	for _, state := range m.States() {
+		if state.parent == nil {
+			states = append(states, state)
+		}
+	}
+
+	return states
+}
+
+func (m *Machine) currentStates() stateSet {
+	current := make(stateSet)
+	for _, name := range m.Configuration() {
+		current[m.stateByName[name]] = true
+	}
+
+	return current
+}
+
+func transitionLabel(transition *Transition) string {
+	label := transition.Name()
+
+	if transition.event != nil && transition.event.Name() != transition.Name() {
+		label += " (" + transition.event.Name() + ")"
+	}
+
+	if transition.guard != nil {
+		label += " [guarded]"
+	}
+
+	return label
+}
+
+func historyLabel(state *State) string {
+	if state.history == DeepHistory {
+		return "H*"
+	}
+
+	return "H"
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func diagramID(state *State) string {
+	return nonIdentifierPattern.ReplaceAllString(state.Name(), "_")
+}
+
+func diagramChildren(state *State) []*State {
+	return append(append([]*State{}, state.children...), state.histories...)
+}
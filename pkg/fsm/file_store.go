@@ -0,0 +1,145 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type FileStore struct {
+	mu  *sync.Mutex
+	dir string
+}
+
+func NewFileStore(
+	dir string,
+) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := FileStore{
+		mu:  new(sync.Mutex),
+		dir: dir,
+	}
+
+	return &s, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+func (s *FileStore) lock(ctx context.Context, id string) (func(), error) {
+	// the lock file keeps other processes sharing the directory out while we compare and swap
+	lockPath := s.path(id) + ".lock"
+
+	for {
+		unlock, ok, err := tryLock(lockPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return unlock, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to lock %#+v: %w", lockPath, ctx.Err())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func (s *FileStore) load(id string) (Snapshot, error) {
+	snapshot := Snapshot{}
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return snapshot, fmt.Errorf("id %#+v: %w", id, ErrSnapshotNotFound)
+		}
+
+		return snapshot, err
+	}
+
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(id)
+}
+
+func (s *FileStore) Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	version := int64(0)
+
+	existing, err := s.load(id)
+	if err == nil {
+		version = existing.Version
+	} else if !errors.Is(err, ErrSnapshotNotFound) {
+		return err
+	}
+
+	if version != expectedVersion {
+		return fmt.Errorf(
+			"id %#+v at version %v, expected %v: %w",
+			id, version, expectedVersion, ErrVersionConflict,
+		)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, url.PathEscape(id)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	err = os.Rename(f.Name(), s.path(id))
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package fsm
+
+import (
+	"errors"
+	"os"
+)
+
+// without flock the lock is the file's existence, so one left behind by a crashed process has to be removed by hand
+func tryLock(lockPath string) (func(), bool, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	_ = f.Close()
+
+	return func() {
+		_ = os.Remove(lockPath)
+	}, true, nil
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package fsm
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// the kernel releases an advisory lock when its holder exits, so a crashed process can't leave the lock held
+func tryLock(lockPath string) (func(), bool, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = f.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return func() {
+		// the file is left in place; removing it would let another process lock a new file while this one is held
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, true, nil
+}
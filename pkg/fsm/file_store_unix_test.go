@@ -0,0 +1,43 @@
+//go:build unix
+
+package fsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+
+	// a lock file left behind by a crashed process doesn't hold the lock
+	err := os.WriteFile(filepath.Join(dir, "connector%2F1.json.lock"), nil, 0o644)
+	require.NoError(t, err)
+
+	store1, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	store2, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	unlock, err := store1.lock(context.Background(), "connector/1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	err = store2.Save(ctx, "connector/1", Snapshot{State: "state_a", Version: 1}, 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlock()
+
+	err = store2.Save(context.Background(), "connector/1", Snapshot{State: "state_a", Version: 1}, 0)
+	require.NoError(t, err)
+
+	err = store1.Save(context.Background(), "connector/1", Snapshot{State: "state_b", Version: 1}, 0)
+	require.ErrorIs(t, err, ErrVersionConflict)
+}
@@ -0,0 +1,118 @@
+package fsmtest
+
+import (
+	"sync"
+	"time"
+)
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	f        func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t)
+}
+
+type FakeClock struct {
+	mu     *sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	c := FakeClock{
+		mu:     new(sync.Mutex),
+		now:    now,
+		timers: make([]*fakeTimer, 0),
+	}
+
+	return &c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) interface{ Stop() bool } {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		f:        f,
+	}
+
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *FakeClock) next(until time.Time) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var next *fakeTimer
+	for _, t := range c.timers {
+		if t.deadline.After(until) {
+			continue
+		}
+
+		if next == nil || t.deadline.Before(next.deadline) {
+			next = t
+		}
+	}
+
+	if next == nil {
+		c.now = until
+		return nil
+	}
+
+	if next.deadline.After(c.now) {
+		c.now = next.deadline
+	}
+
+	return next
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	until := c.Now().Add(d)
+
+	// timers fire synchronously in deadline order, including any scheduled by the timers that fire
+	for {
+		t := c.next(until)
+		if t == nil {
+			return
+		}
+
+		if t.Stop() {
+			t.f()
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package fsm
+
+import "fmt"
+
+type Guard func(scope Scope) bool
+
+type GuardRejectedError struct {
+	Event       string
+	Transition  string
+	Source      string
+	Destination string
+}
+
+func (e *GuardRejectedError) Error() string {
+	message := "transition"
+
+	if e.Transition != "" {
+		message += fmt.Sprintf(" %#+v", e.Transition)
+	}
+
+	if e.Event != "" {
+		message += fmt.Sprintf(" for event %#+v", e.Event)
+	}
+
+	message += fmt.Sprintf(" from %#+v", e.Source)
+
+	if e.Destination != "" {
+		message += fmt.Sprintf(" to %#+v", e.Destination)
+	}
+
+	return message + " rejected by guard"
+}
+
+func (e *GuardRejectedError) Is(target error) bool {
+	return target == ErrGuardRejected
+}
@@ -0,0 +1,43 @@
+package fsm
+
+import "fmt"
+
+type History int
+
+const (
+	NoHistory History = iota
+	ShallowHistory
+	DeepHistory
+)
+
+func newHistory(
+	name string,
+	parent *State,
+	history History,
+) *State {
+	if parent == nil {
+		panic(fmt.Sprintf("history state %#+v parent unexpectedly nil", name))
+	}
+
+	s := NewState(name, nil, nil)
+	s.parent = parent
+	s.history = history
+
+	parent.histories = append(parent.histories, s)
+
+	return s
+}
+
+func NewShallowHistory(
+	name string,
+	parent *State,
+) *State {
+	return newHistory(name, parent, ShallowHistory)
+}
+
+func NewDeepHistory(
+	name string,
+	parent *State,
+) *State {
+	return newHistory(name, parent, DeepHistory)
+}
@@ -0,0 +1,69 @@
+package fsm
+
+import "context"
+
+func (m *Machine) InitialState() *State {
+	return m.initialState
+}
+
+func (m *Machine) States() []*State {
+	states := make(stateSet)
+	for _, state := range m.stateByName {
+		states[state] = true
+	}
+
+	return m.sortedStates(states)
+}
+
+func (m *Machine) Transitions() []*Transition {
+	return append([]*Transition{}, m.transitions...)
+}
+
+// guards are run as they would be for the transition, but against the published snapshot and without the machine's
+// lock, so they must be safe to call alongside callbacks and from any goroutine
+func (m *Machine) AvailableTransitions(ctx context.Context) []*Transition {
+	available := make(map[*Transition]bool)
+
+	for _, name := range m.snapshot.Load().Configuration {
+		resolved := make(map[string]bool)
+
+		for state := m.stateByName[name]; state != nil; state = state.parent {
+			for _, transition := range m.transitionsBySource[state] {
+				if resolved[transition.Name()] {
+					continue
+				}
+
+				scope := Scope{Context: ctx}.withTransition(transition)
+				if transition.event != nil {
+					scope.Event = transition.event.Name()
+				}
+
+				if !transition.allowed(scope) {
+					continue
+				}
+
+				resolved[transition.Name()] = true
+				available[transition] = true
+			}
+		}
+	}
+
+	transitions := make([]*Transition, 0)
+	for _, transition := range m.transitions {
+		if available[transition] {
+			transitions = append(transitions, transition)
+		}
+	}
+
+	return transitions
+}
+
+func (m *Machine) CanTransition(ctx context.Context, name string) bool {
+	for _, transition := range m.AvailableTransitions(ctx) {
+		if transition.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package fsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type introspectionKey struct{}
+
+func TestMachineIntrospection(t *testing.T) {
+	allowed := false
+	guardScopes := make([]Scope, 0)
+
+	guard := func(scope Scope) bool {
+		guardScopes = append(guardScopes, scope)
+		return allowed
+	}
+
+	stateA := NewState("state_a", nil, nil)
+	stateB1 := NewState("state_b_1", nil, nil)
+	stateB2 := NewState("state_b_2", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1, stateB2))
+	stateBHistory := NewShallowHistory("state_b_history", stateB)
+	stateC := NewState("state_c", nil, nil)
+
+	transitionAB := NewTransition("transition_a_b", stateA, stateB, nil, nil)
+	transitionAC := NewTransition("transition_a_c", stateA, stateC, nil, nil, WithGuard(guard))
+	transitionBNext := NewTransition("transition_b_next", stateB1, stateB2, nil, nil)
+	transitionBLeave1 := NewTransition("transition_b_leave", stateB1, stateC, nil, nil)
+	transitionBLeave := NewTransition("transition_b_leave", stateB, stateA, nil, nil)
+	transitionCB := NewTransition("transition_c_b", stateC, stateBHistory, nil, nil)
+
+	transitions := []*Transition{
+		transitionAB,
+		transitionAC,
+		transitionBNext,
+		transitionBLeave1,
+		transitionBLeave,
+		transitionCB,
+	}
+
+	m, err := NewMachine([]*State{stateA, stateB, stateC}, transitions, stateA)
+	require.NoError(t, err)
+
+	require.Equal(t, stateA, m.InitialState())
+	require.Equal(t, []*State{stateA, stateB, stateB1, stateB2, stateBHistory, stateC}, m.States())
+	require.Equal(t, transitions, m.Transitions())
+
+	ctx := context.WithValue(context.Background(), introspectionKey{}, "value")
+
+	require.Equal(t, []*Transition{transitionAB}, m.AvailableTransitions(ctx))
+	require.False(t, transitionAB.HasGuard())
+	require.True(t, transitionAC.HasGuard())
+	require.True(t, m.CanTransition(ctx, "transition_a_b"))
+	require.False(t, m.CanTransition(ctx, "transition_a_c"))
+	require.False(t, m.CanTransition(ctx, "transition_d"))
+	require.Equal(t, "transition_a_c", guardScopes[0].Transition)
+	require.Equal(t, "state_c", guardScopes[0].Destination)
+	require.Equal(t, "value", guardScopes[0].Context.Value(introspectionKey{}))
+
+	allowed = true
+	require.Equal(t, []*Transition{transitionAB, transitionAC}, m.AvailableTransitions(ctx))
+	require.True(t, m.CanTransition(ctx, "transition_a_c"))
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateA, m.InitialState())
+	require.Equal(t, []*Transition{transitionBNext, transitionBLeave1}, m.AvailableTransitions(ctx))
+
+	_, err = m.Transition("transition_b_next", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*Transition{transitionBLeave}, m.AvailableTransitions(ctx))
+	require.False(t, m.CanTransition(ctx, "transition_b_next"))
+}
@@ -0,0 +1,270 @@
+package fsm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	TransitionEntry  = "transition"
+	FireEntry        = "fire"
+	ChangeStateEntry = "change_state"
+	TimeoutEntry     = "timeout"
+)
+
+type JournalTransition struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type JournalEntry struct {
+	Kind        string              `json:"kind"`
+	Name        string              `json:"name"`
+	Payload     json.RawMessage     `json:"payload,omitempty"`
+	Source      string              `json:"source"`
+	Destination string              `json:"destination,omitempty"`
+	Transitions []JournalTransition `json:"transitions,omitempty"`
+	Timestamp   time.Time           `json:"timestamp"`
+	Version     int64               `json:"version"`
+	Error       string              `json:"error,omitempty"`
+	Aborted     bool                `json:"aborted,omitempty"`
+}
+
+type Journal interface {
+	Append(ctx context.Context, entry JournalEntry) error
+}
+
+func WithJournal(journal Journal) MachineOption {
+	return func(m *Machine) error {
+		m.journal = journal
+
+		return nil
+	}
+}
+
+type MemoryJournal struct {
+	mu      *sync.Mutex
+	entries []JournalEntry
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	j := MemoryJournal{
+		mu:      new(sync.Mutex),
+		entries: make([]JournalEntry, 0),
+	}
+
+	return &j
+}
+
+func (j *MemoryJournal) Append(ctx context.Context, entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, entry)
+
+	return nil
+}
+
+func (j *MemoryJournal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]JournalEntry{}, j.entries...)
+}
+
+type WriterJournal struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterJournal(w io.Writer) *WriterJournal {
+	j := WriterJournal{
+		mu: new(sync.Mutex),
+		w:  w,
+	}
+
+	return &j
+}
+
+func (j *WriterJournal) Append(ctx context.Context, entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.w.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	entries := make([]JournalEntry, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := JournalEntry{}
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal line %v: %w", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r request) journalEntry(source string) (JournalEntry, error) {
+	entry := JournalEntry{
+		Name:   r.name,
+		Source: source,
+	}
+
+	switch r.kind {
+	case fireRequest:
+		entry.Kind = FireEntry
+	case changeStateRequest:
+		entry.Kind = ChangeStateEntry
+	case timeoutRequest:
+		entry.Kind = TimeoutEntry
+		entry.Name = r.timer.timeout.transition
+	default:
+		entry.Kind = TransitionEntry
+	}
+
+	if r.payload != nil {
+		payload, err := json.Marshal(r.payload)
+		if err != nil {
+			return entry, fmt.Errorf("failed to serialise payload of %v: %w", r, err)
+		}
+
+		entry.Payload = payload
+	}
+
+	return entry, nil
+}
+
+func (m *Machine) Replay(ctx context.Context, entries []JournalEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// requests made by callbacks during a replay were journaled themselves, so the queue is discarded
+	d := newDispatcher(m)
+	defer d.finish()
+
+	ctx = context.WithValue(ctx, dispatcherKey{}, d)
+
+	for i, entry := range entries {
+		if entry.Error != "" {
+			continue
+		}
+
+		// an attempt journaled ahead of a failed save is immediately followed by its aborted entry
+		if i+1 < len(entries) && entries[i+1].Aborted {
+			continue
+		}
+
+		err := m.replay(ctx, entry)
+		if err != nil {
+			m.publish()
+
+			return fmt.Errorf("failed to replay journal entry %v (%v %#+v): %w", i, entry.Kind, entry.Name, err)
+		}
+
+		d.mu.Lock()
+		d.queue = nil
+		d.mu.Unlock()
+	}
+
+	m.publish()
+
+	return nil
+}
+
+func (m *Machine) replay(ctx context.Context, entry JournalEntry) error {
+	if m.State() != entry.Source {
+		return errorf(ErrReplayDiverged, "current state %#+v not source %#+v", m.State(), entry.Source)
+	}
+
+	transitions := make([]*Transition, 0)
+
+	for _, journalTransition := range entry.Transitions {
+		var found *Transition
+
+		for _, transition := range m.transitionsBySource[m.stateByName[journalTransition.Source]] {
+			if transition.Name() == journalTransition.Name &&
+				transition.destination.Name() == journalTransition.Destination {
+				found = transition
+				break
+			}
+		}
+
+		if found == nil || !m.active[found.source] {
+			return errorf(
+				ErrReplayDiverged,
+				"transition %#+v from %#+v to %#+v not valid for current state %#+v",
+				journalTransition.Name, journalTransition.Source, journalTransition.Destination, m.State(),
+			)
+		}
+
+		transitions = append(transitions, found)
+	}
+
+	if len(transitions) == 0 {
+		return errorf(ErrReplayDiverged, "no transitions")
+	}
+
+	scope := Scope{
+		Payload: entry.Payload,
+		Context: ctx,
+		Replay:  true,
+	}
+
+	if entry.Kind == FireEntry {
+		scope.Event = entry.Name
+	}
+
+	m.replayTimestamp = entry.Timestamp
+	defer func() {
+		m.replayTimestamp = time.Time{}
+	}()
+
+	_, err := m.transition(transitions, scope)
+	if err != nil {
+		return err
+	}
+
+	m.lastTimestamp = entry.Timestamp
+	m.version = entry.Version
+	m.publish()
+
+	if m.State() != entry.Destination {
+		return errorf(ErrReplayDiverged, "destination %#+v not reached, at %#+v", entry.Destination, m.State())
+	}
+
+	return nil
+}
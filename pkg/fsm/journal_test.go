@@ -0,0 +1,197 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/initialed85/stato/pkg/fsm/fsmtest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMachineJournal(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := fsmtest.NewFakeClock(start)
+
+	replayed := make([]bool, 0)
+	failEnter := false
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		enter := func(scope Scope) (context.Context, error) {
+			replayed = append(replayed, scope.Replay)
+
+			if failEnter && !scope.Replay {
+				return nil, fmt.Errorf("failed")
+			}
+
+			return scope.Context, nil
+		}
+
+		startEvent := NewEvent("start")
+
+		stateA := NewState("state_a", nil, nil)
+		stateB := NewState("state_b", enter, nil, WithTimeout(time.Second*10, "transition_b_a"))
+		stateC := NewState("state_c", enter, nil)
+
+		return NewMachine(
+			[]*State{stateA, stateB, stateC},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, nil, nil, WithEvent(startEvent)),
+				NewTransition("transition_b_a", stateB, stateA, nil, nil),
+				NewTransition("transition_b_c", stateB, stateC, nil, nil),
+			},
+			stateA,
+			append([]MachineOption{WithClock(clock)}, opts...)...,
+		)
+	}
+
+	buf := new(bytes.Buffer)
+
+	m, err := newMachine(WithJournal(NewWriterJournal(buf)))
+	require.NoError(t, err)
+
+	_, err = m.Fire(context.Background(), "start", map[string]string{"id_tag": "abc123"})
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.Error(t, err)
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, "state_a", m.State())
+
+	_, err = m.Fire(context.Background(), "start", nil)
+	require.NoError(t, err)
+
+	failEnter = true
+	_, err = m.ChangeState(context.Background(), "state_c")
+	require.Error(t, err)
+	failEnter = false
+
+	clock.Advance(time.Second)
+
+	_, err = m.ChangeState(context.Background(), "state_c")
+	require.NoError(t, err)
+
+	entries, err := ReadJournal(buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+
+	require.Equal(
+		t,
+		JournalEntry{
+			Kind:        FireEntry,
+			Name:        "start",
+			Payload:     json.RawMessage(`{"id_tag":"abc123"}`),
+			Source:      "state_a",
+			Destination: "state_b",
+			Transitions: []JournalTransition{{Name: "transition_a_b", Source: "state_a", Destination: "state_b"}},
+			Timestamp:   start,
+			Version:     1,
+		},
+		entries[0],
+	)
+
+	require.Equal(t, TransitionEntry, entries[1].Kind)
+	require.Equal(t, "state_b", entries[1].Source)
+	require.Equal(t, "", entries[1].Destination)
+	require.Equal(t, int64(1), entries[1].Version)
+	require.NotEmpty(t, entries[1].Error)
+
+	require.Equal(t, TimeoutEntry, entries[2].Kind)
+	require.Equal(t, "transition_b_a", entries[2].Name)
+	require.Equal(t, "state_a", entries[2].Destination)
+	require.Equal(t, start.Add(time.Second*10), entries[2].Timestamp)
+
+	require.Equal(t, ChangeStateEntry, entries[4].Kind)
+	require.Equal(
+		t,
+		`state enter failed for state "state_c" during transition "transition_b_c" from "state_b" to "state_c": failed`,
+		entries[4].Error,
+	)
+
+	require.Equal(t, ChangeStateEntry, entries[5].Kind)
+	require.Equal(t, "state_c", entries[5].Destination)
+	require.Equal(t, int64(4), entries[5].Version)
+
+	replayed = make([]bool, 0)
+
+	restored, err := newMachine()
+	require.NoError(t, err)
+
+	err = restored.Replay(context.Background(), entries)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, true, true}, replayed)
+	require.Equal(t, m.State(), restored.State())
+	require.Equal(t, m.Snapshot().Version, restored.Snapshot().Version)
+	require.Equal(t, m.Snapshot().Timestamp, restored.Snapshot().Timestamp)
+	require.Equal(t, "transition_b_c", restored.Snapshot().Transition)
+
+	restored, err = newMachine()
+	require.NoError(t, err)
+
+	err = restored.Replay(context.Background(), entries[2:])
+	require.Error(t, err)
+	require.Equal(t, "state_a", restored.State())
+}
+
+type journalPayload struct {
+	IDTag string `json:"id_tag"`
+}
+
+func TestMachineReplayPayloadAndTimers(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := fsmtest.NewFakeClock(start)
+
+	payloads := make([]any, 0)
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", nil, nil)
+		stateB := NewState(
+			"state_b",
+			func(scope Scope) (context.Context, error) {
+				payloads = append(payloads, scope.Payload)
+				return scope.Context, nil
+			},
+			nil,
+			WithTimeout(time.Second*10, "transition_b_a"),
+		)
+
+		return NewMachine(
+			[]*State{stateA, stateB},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, nil, nil, WithEvent(NewEvent("start"))),
+				NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			},
+			stateA,
+			append([]MachineOption{WithClock(clock)}, opts...)...,
+		)
+	}
+
+	journal := NewMemoryJournal()
+
+	m, err := newMachine(WithJournal(journal))
+	require.NoError(t, err)
+
+	_, err = m.Fire(context.Background(), "start", journalPayload{IDTag: "abc123"})
+	require.NoError(t, err)
+	require.Equal(t, journalPayload{IDTag: "abc123"}, payloads[0])
+
+	restored, err := newMachine(WithClock(fsmtest.NewFakeClock(start.Add(time.Hour))))
+	require.NoError(t, err)
+
+	err = restored.Replay(context.Background(), journal.Entries())
+	require.NoError(t, err)
+
+	rawPayload, ok := payloads[1].(json.RawMessage)
+	require.True(t, ok)
+
+	payload := journalPayload{}
+	err = json.Unmarshal(rawPayload, &payload)
+	require.NoError(t, err)
+	require.Equal(t, journalPayload{IDTag: "abc123"}, payload)
+
+	require.Equal(t, m.Snapshot().Timers, restored.Snapshot().Timers)
+	require.Equal(t, start.Add(time.Second*10), restored.Snapshot().Timers[0].Deadline)
+}
@@ -0,0 +1,107 @@
+package fsm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Listener interface {
+	BeforeTransition(scope Scope)
+	AfterTransition(scope Scope)
+	TransitionFailed(scope Scope, err error)
+	StateEntered(scope Scope)
+	StateExited(scope Scope)
+}
+
+type ListenerFuncs struct {
+	BeforeTransitionFunc func(scope Scope)
+	AfterTransitionFunc  func(scope Scope)
+	TransitionFailedFunc func(scope Scope, err error)
+	StateEnteredFunc     func(scope Scope)
+	StateExitedFunc      func(scope Scope)
+}
+
+func (l ListenerFuncs) BeforeTransition(scope Scope) {
+	if l.BeforeTransitionFunc != nil {
+		l.BeforeTransitionFunc(scope)
+	}
+}
+
+func (l ListenerFuncs) AfterTransition(scope Scope) {
+	if l.AfterTransitionFunc != nil {
+		l.AfterTransitionFunc(scope)
+	}
+}
+
+func (l ListenerFuncs) TransitionFailed(scope Scope, err error) {
+	if l.TransitionFailedFunc != nil {
+		l.TransitionFailedFunc(scope, err)
+	}
+}
+
+func (l ListenerFuncs) StateEntered(scope Scope) {
+	if l.StateEnteredFunc != nil {
+		l.StateEnteredFunc(scope)
+	}
+}
+
+func (l ListenerFuncs) StateExited(scope Scope) {
+	if l.StateExitedFunc != nil {
+		l.StateExitedFunc(scope)
+	}
+}
+
+type listeners struct {
+	mu      *sync.Mutex
+	entries *atomic.Pointer[[]*listenerEntry]
+}
+
+type listenerEntry struct {
+	listener Listener
+}
+
+func newListeners() *listeners {
+	l := listeners{
+		mu:      new(sync.Mutex),
+		entries: new(atomic.Pointer[[]*listenerEntry]),
+	}
+
+	l.entries.Store(&[]*listenerEntry{})
+
+	return &l
+}
+
+func (l *listeners) add(listener Listener) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := &listenerEntry{listener: listener}
+
+	// copy on write so notifying never takes the lock and listeners can be changed from inside a listener
+	entries := append(append([]*listenerEntry{}, *l.entries.Load()...), e)
+	l.entries.Store(&entries)
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		entries := make([]*listenerEntry, 0)
+		for _, other := range *l.entries.Load() {
+			if other != e {
+				entries = append(entries, other)
+			}
+		}
+
+		l.entries.Store(&entries)
+	}
+}
+
+func (l *listeners) each(f func(listener Listener)) {
+	for _, e := range *l.entries.Load() {
+		f(e.listener)
+	}
+}
+
+func (m *Machine) AddListener(listener Listener) func() {
+	return m.listeners.add(listener)
+}
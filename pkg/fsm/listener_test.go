@@ -0,0 +1,124 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestMachineListener(t *testing.T) {
+	failEnter := false
+
+	stateA := NewState("state_a", nil, nil)
+	stateB1 := NewState("state_b_1", nil, nil)
+	stateB2 := NewState(
+		"state_b_2",
+		func(scope Scope) (context.Context, error) {
+			if failEnter {
+				return nil, fmt.Errorf("failed")
+			}
+
+			return scope.Context, nil
+		},
+		nil,
+	)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1, stateB2))
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			NewTransition("transition_b_next", stateB1, stateB2, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	calls := make([]string, 0)
+
+	remove := m.AddListener(ListenerFuncs{
+		BeforeTransitionFunc: func(scope Scope) {
+			calls = append(calls, "before "+scope.Transition)
+		},
+		AfterTransitionFunc: func(scope Scope) {
+			calls = append(calls, "after "+scope.Transition)
+		},
+		TransitionFailedFunc: func(scope Scope, err error) {
+			calls = append(calls, fmt.Sprintf("failed %v: %v", scope.Transition, err))
+		},
+		StateEnteredFunc: func(scope Scope) {
+			calls = append(calls, "entered "+scope.State)
+		},
+		StateExitedFunc: func(scope Scope) {
+			calls = append(calls, "exited "+scope.State)
+		},
+	})
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	failEnter = true
+	_, err = m.Transition("transition_b_next", context.Background())
+	require.Error(t, err)
+	failEnter = false
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.Error(t, err)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	require.Equal(
+		t,
+		[]string{
+			"before transition_a_b",
+			"exited state_a",
+			"entered state_b",
+			"entered state_b_1",
+			"after transition_a_b",
+			"before transition_b_next",
+			`failed transition_b_next: state enter failed for state "state_b_2" during transition "transition_b_next" from "state_b_1" to "state_b_2": failed`,
+			`failed transition_a_b: transition "transition_a_b" not valid for current state "state_b_1"`,
+			"before transition_b_a",
+			"exited state_b_1",
+			"exited state_b",
+			"entered state_a",
+			"after transition_b_a",
+		},
+		calls,
+	)
+
+	remove()
+	calls = make([]string, 0)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				remove := m.AddListener(ListenerFuncs{})
+				remove()
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		_, err = m.Transition("transition_b_a", context.Background())
+		require.NoError(t, err)
+
+		_, err = m.Transition("transition_a_b", context.Background())
+		require.NoError(t, err)
+	}
+
+	wg.Wait()
+}
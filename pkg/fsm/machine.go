@@ -2,121 +2,730 @@ package fsm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Machine struct {
-	implySelfTransition      bool
-	mu                       *sync.Mutex
-	stateByName              map[string]*State
-	transitionBySourceByName map[string]map[*State]*Transition
-	initialState             *State
-	currentState             *State
+	implySelfTransition       bool
+	mu                        *sync.Mutex
+	stateByName               map[string]*State
+	eventByName               map[string]*Event
+	transitions               []*Transition
+	transitionsBySource       map[*State][]*Transition
+	transitionBySourceByName  map[string]map[*State][]*Transition
+	transitionBySourceByEvent map[string]map[*State][]*Transition
+	orderByState              map[*State]int
+	initialState              *State
+	active                    stateSet
+	historyByState            map[*State][]*State
+	snapshot                  *atomic.Pointer[Snapshot]
+	maxQueueDepth             int
+	clock                     Clock
+	timers                    map[*pendingTimer]bool
+	lastTransition            string
+	lastTimestamp             time.Time
+	version                   int64
+	restoredSnapshot          *Snapshot
+	store                     Store
+	storeID                   string
+	journal                   Journal
+	pendingEntry              *JournalEntry
+	journaled                 bool
+	replayTimestamp           time.Time
+	listeners                 *listeners
+	attempted                 bool
+	middleware                []Middleware
+	recoverPanics             bool
+}
+
+type MachineOption func(m *Machine) error
+
+func addCandidate(
+	transitionBySource map[*State][]*Transition,
+	transition *Transition,
+) error {
+	for _, candidate := range transitionBySource[transition.GetSource()] {
+		if candidate.guard == nil {
+			return errorf(
+				ErrDuplicateTransition,
+				"transition %#+v already exists for source %#+v",
+				transition.Name(), transition.GetSource().Name(),
+			)
+		}
+	}
+
+	transitionBySource[transition.GetSource()] = append(
+		transitionBySource[transition.GetSource()],
+		transition,
+	)
+
+	return nil
 }
 
 func NewMachine(
 	states []*State,
 	transitions []*Transition,
 	initialState *State,
+	opts ...MachineOption,
 ) (*Machine, error) {
 	m := Machine{
-		mu:                       new(sync.Mutex),
-		stateByName:              make(map[string]*State),
-		transitionBySourceByName: make(map[string]map[*State]*Transition),
+		mu:                        new(sync.Mutex),
+		stateByName:               make(map[string]*State),
+		eventByName:               make(map[string]*Event),
+		transitions:               make([]*Transition, 0),
+		transitionsBySource:       make(map[*State][]*Transition),
+		transitionBySourceByName:  make(map[string]map[*State][]*Transition),
+		transitionBySourceByEvent: make(map[string]map[*State][]*Transition),
+		orderByState:              make(map[*State]int),
+		active:                    make(stateSet),
+		historyByState:            make(map[*State][]*State),
+		snapshot:                  new(atomic.Pointer[Snapshot]),
+		maxQueueDepth:             defaultMaxQueueDepth,
+		clock:                     realClock{},
+		timers:                    make(map[*pendingTimer]bool),
+		listeners:                 newListeners(),
 	}
 
 	for _, state := range states {
-		_, ok := m.stateByName[state.Name()]
-		if ok {
-			return nil, fmt.Errorf("state %#+v already exists", state.Name())
+		err := m.addState(state)
+		if err != nil {
+			return nil, err
 		}
-		m.stateByName[state.Name()] = state
 	}
 
 	for _, transition := range transitions {
-		transitionBySource, ok := m.transitionBySourceByName[transition.Name()]
-		if !ok {
-			transitionBySource = make(map[*State]*Transition)
+		for _, state := range []*State{transition.GetSource(), transition.GetDestination()} {
+			if m.stateByName[state.Name()] != state {
+				return nil, errorf(
+					ErrUnknownState,
+					"transition %#+v state %#+v not in states",
+					transition.Name(), state.Name(),
+				)
+			}
 		}
 
-		_, ok = transitionBySource[transition.source]
-		if ok {
-			return nil, fmt.Errorf(
-				"transition %#+v already exists for source %#+v",
+		if transition.GetSource().history != NoHistory {
+			return nil, errorf(
+				ErrInvalidDefinition,
+				"transition %#+v source %#+v is a history state",
 				transition.Name(), transition.GetSource().Name(),
 			)
 		}
 
-		transitionBySource[transition.GetSource()] = transition
-		m.transitionBySourceByName[transition.Name()] = transitionBySource
+		transitionBySource, ok := m.transitionBySourceByName[transition.Name()]
+		if !ok {
+			transitionBySource = make(map[*State][]*Transition)
+			m.transitionBySourceByName[transition.Name()] = transitionBySource
+		}
+
+		err := addCandidate(transitionBySource, transition)
+		if err != nil {
+			return nil, err
+		}
+
+		event := transition.GetEvent()
+		if event != nil {
+			existingEvent, ok := m.eventByName[event.Name()]
+			if ok && existingEvent != event {
+				return nil, errorf(ErrDuplicateEvent, "event %#+v already exists", event.Name())
+			}
+			m.eventByName[event.Name()] = event
+
+			transitionBySource, ok = m.transitionBySourceByEvent[event.Name()]
+			if !ok {
+				transitionBySource = make(map[*State][]*Transition)
+				m.transitionBySourceByEvent[event.Name()] = transitionBySource
+			}
+
+			err = addCandidate(transitionBySource, transition)
+			if err != nil {
+				return nil, fmt.Errorf("event %#+v: %w", event.Name(), err)
+			}
+		}
+
+		m.transitions = append(m.transitions, transition)
+
+		m.transitionsBySource[transition.GetSource()] = append(
+			m.transitionsBySource[transition.GetSource()],
+			transition,
+		)
 	}
 
 	_, ok := m.stateByName[initialState.Name()]
 	if !ok {
-		return nil, fmt.Errorf("initial state %#+v not in states", initialState.Name())
+		return nil, errorf(ErrUnknownState, "initial state %#+v not in states", initialState.Name())
+	}
+
+	if initialState.history != NoHistory {
+		return nil, errorf(ErrInvalidDefinition, "initial state %#+v is a history state", initialState.Name())
 	}
 
-	m.currentState = initialState
+	m.initialState = initialState
+
+	m.addDescendantsToEnter(initialState, m.active)
+	m.addAncestorsToEnter(initialState, nil, m.active)
+
+	for _, opt := range opts {
+		err := opt(&m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, state := range m.stateByName {
+		for _, timeout := range state.timeouts {
+			_, ok := m.transitionBySourceByName[timeout.transition]
+			if !ok {
+				return nil, errorf(
+					ErrUnknownTransition,
+					"state %#+v timeout transition %#+v not known",
+					state.Name(), timeout.transition,
+				)
+			}
+		}
+	}
+
+	m.lastTimestamp = m.clock.Now()
+
+	// an overdue or zero length timer fires straight away, so it must wait for the machine to be published
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.restoredSnapshot != nil {
+		err := m.restore(*m.restoredSnapshot)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		m.startTimers(m.sortedStates(m.active))
+	}
+
+	m.publish()
 
 	return &m, nil
 }
 
+func (m *Machine) addState(state *State) error {
+	existingState, ok := m.stateByName[state.Name()]
+	if ok {
+		if existingState == state {
+			return nil
+		}
+
+		return errorf(ErrDuplicateState, "state %#+v already exists", state.Name())
+	}
+
+	if state.initialChild != nil && state.initialChild.parent != state {
+		return errorf(
+			ErrInvalidDefinition,
+			"initial child %#+v not a child of state %#+v",
+			state.initialChild.Name(), state.Name(),
+		)
+	}
+
+	if len(state.histories) > 0 && len(state.children) == 0 {
+		return errorf(ErrInvalidDefinition, "state %#+v has history but no children", state.Name())
+	}
+
+	m.stateByName[state.Name()] = state
+	m.orderByState[state] = len(m.orderByState)
+
+	for _, child := range append(state.children, state.histories...) {
+		err := m.addState(child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *Machine) State() string {
-	return m.currentState.Name()
+	return m.snapshot.Load().State
+}
+
+func (m *Machine) Configuration() []string {
+	return m.Snapshot().Configuration
+}
+
+func (m *Machine) History() map[string][]string {
+	return m.Snapshot().History
+}
+
+func containsTransition(transitions []*Transition, transition *Transition) bool {
+	for _, other := range transitions {
+		if other == transition {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Machine) selectTransition(candidates []*Transition, scope Scope) *Transition {
+	for _, candidate := range candidates {
+		if candidate.allowed(scope.withTransition(candidate)) {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+func (m *Machine) resolveTransitions(
+	transitionBySource map[*State][]*Transition,
+	scope Scope,
+) ([]*Transition, []*Transition) {
+	transitions := make([]*Transition, 0)
+	candidates := make([]*Transition, 0)
+	exited := make(stateSet)
+
+	for _, leaf := range m.leaves() {
+		for state := leaf; state != nil; state = state.parent {
+			transition := m.selectTransition(transitionBySource[state], scope)
+			if transition == nil {
+				for _, candidate := range transitionBySource[state] {
+					if !containsTransition(candidates, candidate) {
+						candidates = append(candidates, candidate)
+					}
+				}
+
+				continue
+			}
+
+			exitSet := m.exitSet(transition)
+
+			if !containsTransition(transitions, transition) && !exited.intersects(exitSet) {
+				for state := range exitSet {
+					exited[state] = true
+				}
+
+				transitions = append(transitions, transition)
+			}
+
+			break
+		}
+	}
+
+	return transitions, candidates
 }
 
 func (m *Machine) Transition(name string, ctx context.Context) (context.Context, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.dispatch(ctx, request{kind: transitionRequest, name: name})
+}
+
+func (m *Machine) Fire(ctx context.Context, event string, payload any) (context.Context, error) {
+	return m.dispatch(ctx, request{kind: fireRequest, name: event, payload: payload})
+}
+
+func (m *Machine) ChangeState(ctx context.Context, destination string) (context.Context, error) {
+	return m.dispatch(ctx, request{kind: changeStateRequest, name: destination})
+}
 
+func (m *Machine) handleTransition(ctx context.Context, name string) (context.Context, error) {
 	transitionBySource, ok := m.transitionBySourceByName[name]
 	if !ok {
-		return nil, fmt.Errorf("transition %#+v not known", name)
+		return nil, errorf(ErrUnknownTransition, "transition %#+v not known", name)
 	}
 
-	transition, ok := transitionBySource[m.currentState]
-	if !ok {
-		return nil, fmt.Errorf(
+	return m.handleTransitionFrom(ctx, name, transitionBySource)
+}
+
+func (m *Machine) handleTransitionFrom(
+	ctx context.Context,
+	name string,
+	transitionBySource map[*State][]*Transition,
+) (context.Context, error) {
+	scope := Scope{Context: ctx}
+
+	transitions, candidates := m.resolveTransitions(transitionBySource, scope)
+	if len(transitions) == 0 && len(candidates) == 0 {
+		return nil, errorf(
+			ErrInvalidTransition,
 			"transition %#+v not valid for current state %#+v",
-			name, m.currentState.Name(),
+			name, m.State(),
 		)
 	}
 
-	getScope := func(ctx context.Context) Scope {
-		return Scope{
-			Transition:  transition.Name(),
-			Source:      transition.source.Name(),
-			Destination: transition.destination.Name(),
-			Context:     ctx,
+	if len(transitions) == 0 {
+		guardRejectedError := &GuardRejectedError{
+			Transition: name,
+			Source:     m.State(),
 		}
+
+		if len(candidates) == 1 {
+			guardRejectedError.Source = candidates[0].source.Name()
+			guardRejectedError.Destination = candidates[0].destination.Name()
+		}
+
+		return nil, guardRejectedError
 	}
 
-	var err error
+	return m.transition(transitions, scope)
+}
+
+func (m *Machine) handleFire(ctx context.Context, event string, payload any) (context.Context, error) {
+	transitionBySource, ok := m.transitionBySourceByEvent[event]
+	if !ok {
+		return nil, errorf(ErrUnknownEvent, "event %#+v not known", event)
+	}
+
+	scope := Scope{
+		Event:   event,
+		Payload: payload,
+		Context: ctx,
+	}
+
+	transitions, candidates := m.resolveTransitions(transitionBySource, scope)
+	if len(transitions) == 0 && len(candidates) == 0 {
+		return nil, errorf(
+			ErrInvalidTransition,
+			"event %#+v not valid for current state %#+v",
+			event, m.State(),
+		)
+	}
+
+	if len(transitions) == 0 {
+		guardRejectedError := &GuardRejectedError{
+			Event:  event,
+			Source: m.State(),
+		}
+
+		if len(candidates) == 1 {
+			guardRejectedError.Transition = candidates[0].Name()
+			guardRejectedError.Source = candidates[0].source.Name()
+			guardRejectedError.Destination = candidates[0].destination.Name()
+		}
+
+		return nil, guardRejectedError
+	}
+
+	return m.transition(transitions, scope)
+}
+
+func (m *Machine) handleChangeState(ctx context.Context, destination string) (context.Context, error) {
+	destinationState, ok := m.stateByName[destination]
+	if !ok {
+		return nil, errorf(ErrUnknownState, "state %#+v not known", destination)
+	}
+
+	scope := Scope{Context: ctx}
+
+	candidates := make([]*Transition, 0)
+	allowed := make([]*Transition, 0)
+
+	// inner states take priority; transitions triggered by an event are only taken when that event is fired
+	for _, leaf := range m.leaves() {
+		for state := leaf; state != nil; state = state.parent {
+			allowedForState := make([]*Transition, 0)
+
+			for _, candidate := range m.transitionsBySource[state] {
+				if candidate.destination != destinationState || candidate.event != nil {
+					continue
+				}
+
+				if !containsTransition(candidates, candidate) {
+					candidates = append(candidates, candidate)
+				}
+
+				if candidate.allowed(scope.withTransition(candidate)) {
+					allowedForState = append(allowedForState, candidate)
+				}
+			}
+
+			if len(allowedForState) == 0 {
+				continue
+			}
+
+			for _, candidate := range allowedForState {
+				if !containsTransition(allowed, candidate) {
+					allowed = append(allowed, candidate)
+				}
+			}
+
+			break
+		}
+	}
+
+	if len(allowed) > 1 {
+		return nil, errorf(
+			ErrAmbiguousTransition,
+			"%v transitions from current state %#+v to %#+v, expected exactly one",
+			len(allowed), m.State(), destination,
+		)
+	}
+
+	if len(allowed) == 1 {
+		return m.transition(allowed, scope)
+	}
+
+	if len(candidates) == 0 {
+		return nil, errorf(
+			ErrInvalidTransition,
+			"no transition from current state %#+v to %#+v",
+			m.State(), destination,
+		)
+	}
+
+	guardRejectedError := &GuardRejectedError{
+		Source:      m.State(),
+		Destination: destination,
+	}
+
+	if len(candidates) == 1 {
+		guardRejectedError.Transition = candidates[0].Name()
+		guardRejectedError.Source = candidates[0].source.Name()
+	}
+
+	return nil, guardRejectedError
+}
+
+func (m *Machine) transition(transitions []*Transition, scope Scope) (context.Context, error) {
+	ctx := scope.Context
+
+	m.attempted = true
+
+	compensations := make([]Compensation, 0)
+	scope.compensations = &compensations
+
+	previousActive := m.active
+	previousLastTransition := m.lastTransition
+	previousLastTimestamp := m.lastTimestamp
+	previousVersion := m.version
+	previousHistoryByState := make(map[*State][]*State)
+	for state, leaves := range m.historyByState {
+		previousHistoryByState[state] = leaves
+	}
+
+	rollback := func(err error) (context.Context, error) {
+		m.active = previousActive
+		m.historyByState = previousHistoryByState
+		m.lastTransition = previousLastTransition
+		m.lastTimestamp = previousLastTimestamp
+		m.version = previousVersion
+
+		errs := []error{err}
+		for i := len(compensations) - 1; i >= 0; i-- {
+			compensationErr := compensations[i](scope.Context)
+			if compensationErr != nil {
+				errs = append(errs, compensationErr)
+			}
+		}
+
+		if len(errs) > 1 {
+			err = errors.Join(errs...)
+		}
+
+		for _, transition := range transitions {
+			m.listeners.each(func(listener Listener) {
+				listener.TransitionFailed(scope.withTransition(transition), err)
+			})
+		}
 
-	ctx, err = transition.enter(getScope(ctx))
-	if err != nil {
 		return nil, err
 	}
 
-	if transition.destination != transition.source {
-		ctx, err = transition.source.exit(getScope(ctx))
+	getScope := func(ctx context.Context, transition *Transition, state *State) Scope {
+		scope := scope.withTransition(transition)
+		scope.Context = ctx
+
+		if state != nil {
+			scope.State = state.Name()
+		}
+
+		return scope
+	}
+
+	for _, transition := range transitions {
+		m.listeners.each(func(listener Listener) {
+			listener.BeforeTransition(getScope(ctx, transition, nil))
+		})
+	}
+
+	var err error
+
+	for _, transition := range transitions {
+		ctx, err = m.invoke(TransitionEnterCallback, transition.enterCallback, getScope(ctx, transition, nil))
 		if err != nil {
-			return nil, err
+			return rollback(newTransitionError(TransitionEnterPhase, transition, nil, err))
+		}
+	}
+
+	exitedBy := make(map[*State]*Transition)
+	enteredBy := make(map[*State]*Transition)
+	exited := make(stateSet)
+	entered := make(stateSet)
+
+	for _, transition := range transitions {
+		for state := range m.exitSet(transition) {
+			if exited[state] {
+				continue
+			}
+
+			exited[state] = true
+			exitedBy[state] = transition
 		}
+	}
 
-		m.currentState = transition.destination
+	exitOrder := m.sortedStates(exited)
+	for i := len(exitOrder) - 1; i >= 0; i-- {
+		state := exitOrder[i]
 
-		ctx, err = transition.destination.enter(getScope(ctx))
+		ctx, err = m.invoke(StateExitCallback, state.exitCallback, getScope(ctx, exitedBy[state], state))
 		if err != nil {
-			m.currentState = transition.source
-			return nil, err
+			return rollback(newTransitionError(StateExitPhase, exitedBy[state], state, err))
 		}
 	}
 
-	ctx, err = transition.exit(getScope(ctx))
-	if err != nil {
-		return nil, err
+	for _, state := range exitOrder {
+		if len(state.children) == 0 {
+			continue
+		}
+
+		leaves := make([]*State, 0)
+		for _, leaf := range m.leaves() {
+			if leaf.isDescendantOf(state) {
+				leaves = append(leaves, leaf)
+			}
+		}
+
+		m.historyByState[state] = leaves
+	}
+
+	for _, transition := range transitions {
+		for state := range m.entrySet(transition) {
+			if entered[state] {
+				continue
+			}
+
+			entered[state] = true
+			enteredBy[state] = transition
+		}
+	}
+
+	m.active = make(stateSet)
+	for state := range previousActive {
+		if !exited[state] {
+			m.active[state] = true
+		}
+	}
+
+	for state := range entered {
+		m.active[state] = true
+	}
+
+	for _, state := range m.sortedStates(entered) {
+		ctx, err = m.invoke(StateEnterCallback, state.enterCallback, getScope(ctx, enteredBy[state], state))
+		if err != nil {
+			return rollback(newTransitionError(StateEnterPhase, enteredBy[state], state, err))
+		}
+	}
+
+	for _, transition := range transitions {
+		ctx, err = m.invoke(TransitionExitCallback, transition.exitCallback, getScope(ctx, transition, nil))
+		if err != nil {
+			return rollback(newTransitionError(TransitionExitPhase, transition, nil, err))
+		}
+	}
+
+	names := make([]string, 0)
+	for _, transition := range transitions {
+		names = append(names, transition.Name())
+	}
+
+	m.lastTransition = strings.Join(names, ",")
+	m.lastTimestamp = m.clock.Now()
+	m.version++
+
+	stoppedTimers := m.stopTimers(exitOrder)
+	startedTimers := m.startTimers(m.sortedStates(entered))
+
+	restoreTimers := func() {
+		for _, p := range startedTimers {
+			p.timer.Stop()
+			delete(m.timers, p)
+		}
+
+		for _, p := range stoppedTimers {
+			m.startTimer(p.state, p.timeout, p.deadline)
+		}
+	}
+
+	snapshot := m.buildSnapshot()
+
+	// the journal is written ahead of the store; a failed save is then journaled as aborted, whereas a failed
+	// append after a save would leave the store ahead of the machine
+	if m.pendingEntry != nil && !scope.Replay {
+		entry := *m.pendingEntry
+		entry.Destination = snapshot.State
+		entry.Timestamp = snapshot.Timestamp
+		entry.Version = snapshot.Version
+
+		for _, transition := range transitions {
+			entry.Transitions = append(entry.Transitions, JournalTransition{
+				Name:        transition.Name(),
+				Source:      transition.source.Name(),
+				Destination: transition.destination.Name(),
+			})
+		}
+
+		err = m.journal.Append(ctx, entry)
+		if err != nil {
+			restoreTimers()
+
+			return rollback(&TransitionError{
+				Phase:       JournalPhase,
+				Transition:  m.lastTransition,
+				Source:      m.State(),
+				Destination: snapshot.State,
+				Err:         err,
+			})
+		}
+
+		m.journaled = true
+	}
+
+	if m.store != nil && !scope.Replay {
+		err = m.store.Save(ctx, m.storeID, snapshot, previousVersion)
+		if err != nil {
+			restoreTimers()
+
+			return rollback(&TransitionError{
+				Phase:       SavePhase,
+				Transition:  m.lastTransition,
+				Source:      m.State(),
+				Destination: snapshot.State,
+				Err:         err,
+			})
+		}
+	}
+
+	m.snapshot.Store(&snapshot)
+
+	// listeners only hear about states once the transition has committed
+	for i := len(exitOrder) - 1; i >= 0; i-- {
+		state := exitOrder[i]
+
+		m.listeners.each(func(listener Listener) {
+			listener.StateExited(getScope(ctx, exitedBy[state], state))
+		})
+	}
+
+	for _, state := range m.sortedStates(entered) {
+		m.listeners.each(func(listener Listener) {
+			listener.StateEntered(getScope(ctx, enteredBy[state], state))
+		})
+	}
+
+	for _, transition := range transitions {
+		m.listeners.each(func(listener Listener) {
+			listener.AfterTransition(getScope(ctx, transition, nil))
+		})
 	}
 
 	return ctx, nil
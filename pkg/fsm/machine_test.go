@@ -2,7 +2,9 @@ package fsm
 
 import (
 	"context"
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 )
 
@@ -276,3 +278,857 @@ func TestMachine(t *testing.T) {
 	require.Equal(t, 4, transitionSelfEnterCallCount)
 	require.Equal(t, 4, transitionSelfExitCallCount)
 }
+
+func TestMachineGuard(t *testing.T) {
+	allowed := false
+	guardCallCount := 0
+	transitionEnterCallCount := 0
+	stateBEnterCallCount := 0
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			stateBEnterCallCount++
+			return scope.Context, nil
+		},
+		nil,
+	)
+
+	transitionAB := NewTransition(
+		"transition_a_b",
+		stateA,
+		stateB,
+		func(scope Scope) (context.Context, error) {
+			transitionEnterCallCount++
+			return scope.Context, nil
+		},
+		nil,
+		WithGuard(func(scope Scope) bool {
+			guardCallCount++
+			require.Equal(t, "transition_a_b", scope.Transition)
+			require.Equal(t, "state_a", scope.Source)
+			require.Equal(t, "state_b", scope.Destination)
+			return allowed
+		}),
+	)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{transitionAB},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	ctx, err := m.Transition(transitionAB.Name(), context.Background())
+	require.Error(t, err)
+	require.Nil(t, ctx)
+	guardRejectedError := &GuardRejectedError{}
+	require.ErrorAs(t, err, &guardRejectedError)
+	require.Equal(t, "transition_a_b", guardRejectedError.Transition)
+	require.Equal(t, stateA.Name(), m.State())
+	require.Equal(t, 1, guardCallCount)
+	require.Equal(t, 0, transitionEnterCallCount)
+	require.Equal(t, 0, stateBEnterCallCount)
+
+	allowed = true
+
+	_, err = m.Transition(transitionAB.Name(), context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+	require.Equal(t, 2, guardCallCount)
+	require.Equal(t, 1, transitionEnterCallCount)
+	require.Equal(t, 1, stateBEnterCallCount)
+}
+
+func TestMachineGuardedChoice(t *testing.T) {
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState("state_b", nil, nil)
+	stateC := NewState("state_c", nil, nil)
+
+	toB := func(scope Scope) bool {
+		return scope.Context.Value("destination") == "state_b"
+	}
+
+	transitionChooseB := NewTransition("transition_choose", stateA, stateB, nil, nil, WithGuard(toB))
+	transitionChooseC := NewTransition("transition_choose", stateA, stateC, nil, nil)
+	transitionResetB := NewTransition("transition_reset", stateB, stateA, nil, nil)
+	transitionResetC := NewTransition("transition_reset", stateC, stateA, nil, nil)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{transitionChooseB, transitionChooseC, transitionResetB, transitionResetC},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_choose", context.WithValue(context.Background(), "destination", "state_b"))
+	require.NoError(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+
+	_, err = m.Transition("transition_reset", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+
+	_, err = m.Transition("transition_choose", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateC.Name(), m.State())
+
+	_, err = NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{transitionChooseC, transitionChooseB},
+		stateA,
+	)
+	require.Error(t, err)
+
+	m, err = NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			transitionChooseB,
+			NewTransition("transition_choose", stateA, stateC, nil, nil, WithGuard(toB)),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_choose", context.Background())
+	guardRejectedError := &GuardRejectedError{}
+	require.ErrorAs(t, err, &guardRejectedError)
+	require.Equal(t, "", guardRejectedError.Destination)
+	require.Equal(t, stateA.Name(), m.State())
+}
+
+func TestMachineChangeState(t *testing.T) {
+	transitionEnterCallCount := 0
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState("state_b", nil, nil)
+	stateC := NewState("state_c", nil, nil)
+
+	allowed := true
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			NewTransition(
+				"transition_a_b",
+				stateA,
+				stateB,
+				func(scope Scope) (context.Context, error) {
+					transitionEnterCallCount++
+					return scope.Context, nil
+				},
+				nil,
+				WithGuard(func(scope Scope) bool {
+					return allowed
+				}),
+			),
+			NewTransition("transition_b_c_1", stateB, stateC, nil, nil),
+			NewTransition("transition_b_c_2", stateB, stateC, nil, nil),
+			NewTransition("transition_c_a", stateC, stateA, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.ChangeState(context.Background(), "state_d")
+	require.Error(t, err)
+
+	_, err = m.ChangeState(context.Background(), stateC.Name())
+	require.Error(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+
+	allowed = false
+
+	_, err = m.ChangeState(context.Background(), stateB.Name())
+	guardRejectedError := &GuardRejectedError{}
+	require.ErrorAs(t, err, &guardRejectedError)
+	require.Equal(t, "transition_a_b", guardRejectedError.Transition)
+	require.Equal(t, stateA.Name(), m.State())
+
+	allowed = true
+
+	_, err = m.ChangeState(context.Background(), stateB.Name())
+	require.NoError(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+	require.Equal(t, 1, transitionEnterCallCount)
+
+	_, err = m.ChangeState(context.Background(), stateC.Name())
+	require.Error(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+
+	_, err = m.Transition("transition_b_c_2", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.ChangeState(context.Background(), stateA.Name())
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+}
+
+func TestMachineFire(t *testing.T) {
+	payloads := make([]any, 0)
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			require.Equal(t, "event_go", scope.Event)
+			payloads = append(payloads, scope.Payload)
+			return scope.Context, nil
+		},
+		nil,
+	)
+	stateC := NewState("state_c", nil, nil)
+
+	eventGo := NewEvent("event_go")
+	eventReset := NewEvent("event_reset")
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			NewTransition(
+				"transition_a_b",
+				stateA,
+				stateB,
+				nil,
+				nil,
+				WithEvent(eventGo),
+				WithGuard(func(scope Scope) bool {
+					return scope.Payload != "state_c"
+				}),
+			),
+			NewTransition("transition_a_c", stateA, stateC, nil, nil, WithEvent(eventGo)),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil, WithEvent(eventReset)),
+			NewTransition("transition_c_a", stateC, stateA, nil, nil, WithEvent(eventReset)),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Fire(context.Background(), "event_unknown", nil)
+	require.Error(t, err)
+
+	_, err = m.Fire(context.Background(), eventReset.Name(), nil)
+	require.Error(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+
+	_, err = m.Fire(context.Background(), eventGo.Name(), "state_b")
+	require.NoError(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+	require.Equal(t, []any{"state_b"}, payloads)
+
+	_, err = m.Fire(context.Background(), eventReset.Name(), nil)
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+
+	_, err = m.ChangeState(context.Background(), stateC.Name())
+	require.Error(t, err)
+
+	_, err = m.Fire(context.Background(), eventGo.Name(), "state_c")
+	require.NoError(t, err)
+	require.Equal(t, stateC.Name(), m.State())
+
+	_, err = m.Transition("transition_c_a", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+
+	_, err = NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil, WithEvent(eventGo)),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil, WithEvent(NewEvent(eventGo.Name()))),
+		},
+		stateA,
+	)
+	require.Error(t, err)
+}
+
+func TestMachineHierarchy(t *testing.T) {
+	calls := make([]string, 0)
+
+	newState := func(name string, opts ...StateOption) *State {
+		return NewState(
+			name,
+			func(scope Scope) (context.Context, error) {
+				require.Equal(t, name, scope.State)
+				calls = append(calls, "enter "+name)
+				return scope.Context, nil
+			},
+			func(scope Scope) (context.Context, error) {
+				require.Equal(t, name, scope.State)
+				calls = append(calls, "exit "+name)
+				return scope.Context, nil
+			},
+			opts...,
+		)
+	}
+
+	stateA := newState("state_a")
+	stateB1 := newState("state_b_1")
+	stateB2 := newState("state_b_2")
+	stateB3 := newState("state_b_3")
+	stateB := newState("state_b", WithChildren(stateB1, stateB2, stateB3), WithInitialChild(stateB2))
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_next", stateB2, stateB3, nil, nil),
+			NewTransition("transition_next", stateB, stateB1, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			NewTransition("transition_self", stateB, stateB, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB2.Name(), m.State())
+	require.Equal(t, []string{"exit state_a", "enter state_b", "enter state_b_2"}, calls)
+
+	calls = calls[:0]
+
+	_, err = m.Transition("transition_next", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB3.Name(), m.State())
+	require.Equal(t, []string{"exit state_b_2", "enter state_b_3"}, calls)
+
+	calls = calls[:0]
+
+	_, err = m.Transition("transition_self", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB3.Name(), m.State())
+	require.Empty(t, calls)
+
+	_, err = m.Transition("transition_next", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB1.Name(), m.State())
+	require.Equal(t, []string{"exit state_b_3", "exit state_b", "enter state_b", "enter state_b_1"}, calls)
+
+	calls = calls[:0]
+
+	_, err = m.ChangeState(context.Background(), stateA.Name())
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+	require.Equal(t, []string{"exit state_b_1", "exit state_b", "enter state_a"}, calls)
+
+	m, err = NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{},
+		stateB,
+	)
+	require.NoError(t, err)
+	require.Equal(t, stateB2.Name(), m.State())
+
+	_, err = NewMachine(
+		[]*State{stateA},
+		[]*Transition{NewTransition("transition_a_b", stateA, stateB, nil, nil)},
+		stateA,
+	)
+	require.Error(t, err)
+}
+
+func TestMachineHistory(t *testing.T) {
+	stateA := NewState("state_a", nil, nil)
+	stateB11 := NewState("state_b_1_1", nil, nil)
+	stateB12 := NewState("state_b_1_2", nil, nil)
+	stateB1 := NewState("state_b_1", nil, nil, WithChildren(stateB11, stateB12))
+	stateB2 := NewState("state_b_2", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1, stateB2))
+	stateBShallow := NewShallowHistory("state_b_shallow", stateB)
+	stateBDeep := NewDeepHistory("state_b_deep", stateB)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_next", stateB11, stateB12, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			NewTransition("transition_shallow", stateA, stateBShallow, nil, nil),
+			NewTransition("transition_deep", stateA, stateBDeep, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+	require.Empty(t, m.History())
+
+	_, err = m.Transition("transition_deep", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB11.Name(), m.State())
+
+	_, err = m.Transition("transition_next", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB12.Name(), m.State())
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+	require.Equal(
+		t,
+		map[string][]string{stateB.Name(): {stateB12.Name()}, stateB1.Name(): {stateB12.Name()}},
+		m.History(),
+	)
+
+	_, err = m.Transition("transition_deep", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB12.Name(), m.State())
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_shallow", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB11.Name(), m.State())
+
+	_, err = NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{NewTransition("transition_history", stateBDeep, stateA, nil, nil)},
+		stateA,
+	)
+	require.Error(t, err)
+}
+
+func TestMachineHistoryRegions(t *testing.T) {
+	stateA := NewState("state_a", nil, nil)
+	stateB11 := NewState("state_b_1_1", nil, nil)
+	stateB12 := NewState("state_b_1_2", nil, nil)
+	stateB1 := NewState("state_b_1", nil, nil, WithChildren(stateB11, stateB12))
+	stateB21 := NewState("state_b_2_1", nil, nil)
+	stateB22 := NewState("state_b_2_2", nil, nil)
+	stateB2 := NewState("state_b_2", nil, nil, WithChildren(stateB21, stateB22))
+	stateBP := NewState("state_b_p", nil, nil, WithRegions(stateB1, stateB2))
+	stateB := NewState("state_b", nil, nil, WithChildren(stateBP))
+	stateBDeep := NewDeepHistory("state_b_deep", stateB)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_1_next", stateB11, stateB12, nil, nil),
+			NewTransition("transition_b_2_next", stateB21, stateB22, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			NewTransition("transition_deep", stateA, stateBDeep, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	for _, name := range []string{"transition_a_b", "transition_b_1_next", "transition_b_2_next", "transition_b_a"} {
+		_, err = m.Transition(name, context.Background())
+		require.NoError(t, err)
+	}
+
+	_, err = m.Transition("transition_deep", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB12.Name(), stateB22.Name()}, m.Configuration())
+
+	for _, name := range []string{"transition_b_a", "transition_a_b", "transition_b_2_next", "transition_b_a"} {
+		_, err = m.Transition(name, context.Background())
+		require.NoError(t, err)
+	}
+
+	_, err = m.Transition("transition_deep", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB11.Name(), stateB22.Name()}, m.Configuration())
+}
+
+func TestMachineRegions(t *testing.T) {
+	calls := make([]string, 0)
+
+	newState := func(name string, opts ...StateOption) *State {
+		return NewState(
+			name,
+			func(scope Scope) (context.Context, error) {
+				calls = append(calls, "enter "+name)
+				return scope.Context, nil
+			},
+			func(scope Scope) (context.Context, error) {
+				calls = append(calls, "exit "+name)
+				return scope.Context, nil
+			},
+			opts...,
+		)
+	}
+
+	stateA := newState("state_a")
+	stateB1A := newState("state_b_1_a")
+	stateB1B := newState("state_b_1_b")
+	stateB1 := newState("state_b_1", WithChildren(stateB1A, stateB1B))
+	stateB2A := newState("state_b_2_a")
+	stateB2B := newState("state_b_2_b")
+	stateB2 := newState("state_b_2", WithChildren(stateB2A, stateB2B))
+	stateB := newState("state_b", WithRegions(stateB1, stateB2))
+
+	eventNext := NewEvent("event_next")
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_a_b_2_b", stateA, stateB2B, nil, nil),
+			NewTransition("transition_b_1_next", stateB1A, stateB1B, nil, nil, WithEvent(eventNext)),
+			NewTransition("transition_b_2_next", stateB2A, stateB2B, nil, nil, WithEvent(eventNext)),
+			NewTransition("transition_b_2_back", stateB2B, stateB2A, nil, nil),
+			NewTransition("transition_b_a", stateB1B, stateA, nil, nil),
+			NewTransition("transition_b_1_across", stateB1A, stateB2B, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB1A.Name(), stateB2A.Name()}, m.Configuration())
+	require.Equal(t, "state_b_1_a,state_b_2_a", m.State())
+	require.Equal(
+		t,
+		[]string{
+			"exit state_a",
+			"enter state_b",
+			"enter state_b_1",
+			"enter state_b_1_a",
+			"enter state_b_2",
+			"enter state_b_2_a",
+		},
+		calls,
+	)
+
+	calls = calls[:0]
+
+	_, err = m.Fire(context.Background(), eventNext.Name(), nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB1B.Name(), stateB2B.Name()}, m.Configuration())
+	require.Equal(
+		t,
+		[]string{
+			"exit state_b_2_a",
+			"exit state_b_1_a",
+			"enter state_b_1_b",
+			"enter state_b_2_b",
+		},
+		calls,
+	)
+
+	_, err = m.Transition("transition_b_2_back", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB1B.Name(), stateB2A.Name()}, m.Configuration())
+
+	calls = calls[:0]
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateA.Name()}, m.Configuration())
+	require.Equal(
+		t,
+		[]string{
+			"exit state_b_2_a",
+			"exit state_b_2",
+			"exit state_b_1_b",
+			"exit state_b_1",
+			"exit state_b",
+			"enter state_a",
+		},
+		calls,
+	)
+
+	_, err = m.Transition("transition_a_b_2_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB1A.Name(), stateB2B.Name()}, m.Configuration())
+
+	_, err = m.Transition("transition_b_2_back", context.Background())
+	require.NoError(t, err)
+
+	calls = calls[:0]
+
+	_, err = m.Transition("transition_b_1_across", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{stateB1A.Name(), stateB2B.Name()}, m.Configuration())
+	require.Equal(
+		t,
+		[]string{
+			"exit state_b_2_a",
+			"exit state_b_2",
+			"exit state_b_1_a",
+			"exit state_b_1",
+			"exit state_b",
+			"enter state_b",
+			"enter state_b_1",
+			"enter state_b_1_a",
+			"enter state_b_2",
+			"enter state_b_2_b",
+		},
+		calls,
+	)
+}
+
+func TestMachineRollback(t *testing.T) {
+	calls := make([]string, 0)
+	failAt := ""
+
+	callback := func(name string) Callback {
+		return func(scope Scope) (context.Context, error) {
+			calls = append(calls, name)
+
+			scope.Compensate(func(ctx context.Context) error {
+				calls = append(calls, "undo "+name)
+				return nil
+			})
+
+			if failAt == name {
+				return nil, fmt.Errorf("%v failed", name)
+			}
+
+			return scope.Context, nil
+		}
+	}
+
+	stateA := NewState("state_a", nil, callback("exit state_a"))
+	stateB := NewState("state_b", callback("enter state_b"), nil)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition(
+				"transition_a_b",
+				stateA,
+				stateB,
+				callback("enter transition_a_b"),
+				callback("exit transition_a_b"),
+			),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	for _, name := range []string{"enter transition_a_b", "exit state_a", "enter state_b", "exit transition_a_b"} {
+		calls = calls[:0]
+		failAt = name
+
+		ctx, err := m.Transition("transition_a_b", context.Background())
+		require.Error(t, err)
+		require.Nil(t, ctx)
+		require.Equal(t, stateA.Name(), m.State())
+
+		expectedCalls := make([]string, 0)
+		for _, call := range []string{"enter transition_a_b", "exit state_a", "enter state_b", "exit transition_a_b"} {
+			expectedCalls = append(expectedCalls, call)
+			if call == name {
+				break
+			}
+		}
+
+		for i := len(expectedCalls) - 1; i >= 0; i-- {
+			expectedCalls = append(expectedCalls, "undo "+expectedCalls[i])
+		}
+
+		require.Equal(t, expectedCalls, calls)
+	}
+
+	calls = calls[:0]
+	failAt = ""
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateB.Name(), m.State())
+	require.Equal(t, []string{"enter transition_a_b", "exit state_a", "enter state_b", "exit transition_a_b"}, calls)
+}
+
+func TestMachineConcurrentReads(t *testing.T) {
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState("state_b", nil, nil)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	snapshot := m.Snapshot()
+	require.Equal(t, stateA.Name(), snapshot.State)
+	require.Equal(t, "", snapshot.Transition)
+	require.False(t, snapshot.Timestamp.IsZero())
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_, _ = m.Transition("transition_a_b", context.Background())
+				_, _ = m.Transition("transition_b_a", context.Background())
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				state := m.State()
+				require.Contains(t, []string{stateA.Name(), stateB.Name()}, state)
+
+				snapshot := m.Snapshot()
+				require.Equal(t, snapshot.State, snapshot.Configuration[0])
+
+				if snapshot.State == stateA.Name() {
+					require.Contains(t, []string{"", "transition_b_a"}, snapshot.Transition)
+				}
+
+				if snapshot.State == stateB.Name() {
+					require.Equal(t, "transition_a_b", snapshot.Transition)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	snapshot = m.Snapshot()
+	require.Equal(t, stateB.Name(), snapshot.State)
+	require.Equal(t, "transition_a_b", snapshot.Transition)
+}
+
+func TestMachineDispatcher(t *testing.T) {
+	var captured context.Context
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			captured = scope.Context
+			return scope.Context, nil
+		},
+		nil,
+	)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+		},
+		stateA,
+	)
+	require.NoError(t, err)
+
+	d := newDispatcher(m)
+
+	queued, err := d.enqueue(request{name: "transition_a_b"})
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	r, ok := d.dequeue()
+	require.True(t, ok)
+	require.Equal(t, "transition_a_b", r.name)
+
+	_, ok = d.dequeue()
+	require.False(t, ok)
+
+	// once the queue has been found empty nothing more can be queued behind it
+	queued, err = d.enqueue(request{name: "transition_a_b"})
+	require.NoError(t, err)
+	require.False(t, queued)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	// a context kept from a finished request is handled on its own rather than queued and dropped
+	_, err = m.Transition("transition_b_a", captured)
+	require.NoError(t, err)
+	require.Equal(t, stateA.Name(), m.State())
+}
+
+func TestMachineReentrant(t *testing.T) {
+	loop := false
+	fail := false
+
+	var m *Machine
+
+	stateA := NewState(
+		"state_a",
+		func(scope Scope) (context.Context, error) {
+			if loop {
+				return m.Transition("transition_a_b", scope.Context)
+			}
+
+			return scope.Context, nil
+		},
+		nil,
+	)
+	stateB := NewState(
+		"state_b",
+		func(scope Scope) (context.Context, error) {
+			if loop {
+				return m.Fire(scope.Context, "event_b_a", nil)
+			}
+
+			if fail {
+				_, err := m.Transition("transition_unknown", scope.Context)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return m.ChangeState(scope.Context, "state_c")
+		},
+		nil,
+	)
+	stateC := NewState("state_c", nil, nil)
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB, stateC},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil, WithEvent(NewEvent("event_b_a"))),
+			NewTransition("transition_b_c", stateB, stateC, nil, nil),
+			NewTransition("transition_c_a", stateC, stateA, nil, nil),
+		},
+		stateA,
+		WithMaxQueueDepth(8),
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stateC.Name(), m.State())
+
+	fail = true
+
+	_, err = m.Transition("transition_c_a", context.Background())
+	require.NoError(t, err)
+
+	ctx, err := m.Transition("transition_a_b", context.Background())
+	require.NotNil(t, ctx)
+	require.ErrorIs(t, err, ErrUnknownTransition)
+	queuedRequestError := &QueuedRequestError{}
+	require.ErrorAs(t, err, &queuedRequestError)
+	require.Len(t, queuedRequestError.Errs, 1)
+	require.Equal(t, stateC.Name(), m.State())
+
+	fail = false
+	loop = true
+
+	ctx, err = m.Transition("transition_c_a", context.Background())
+	require.NotNil(t, ctx)
+	require.ErrorIs(t, err, ErrLoopDetected)
+	require.Contains(t, err.Error(), "possible loop")
+
+	_, err = NewMachine(
+		[]*State{stateA},
+		[]*Transition{},
+		stateA,
+		WithMaxQueueDepth(0),
+	)
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ExportMermaid(m *Machine, opts ...ExportOption) string {
+	o := newExportOptions(opts)
+
+	current := make(stateSet)
+	if o.currentState {
+		current = m.currentStates()
+	}
+
+	b := new(strings.Builder)
+
+	fmt.Fprintf(b, "---\ntitle: %v\n---\n", o.name)
+	b.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(b, "\t[*] --> %v\n", diagramID(m.initialState))
+
+	for _, state := range m.topLevelStates() {
+		writeMermaidState(b, state, "\t")
+	}
+
+	for _, transition := range m.transitions {
+		fmt.Fprintf(
+			b,
+			"\t%v --> %v : %v\n",
+			diagramID(transition.source), diagramID(transition.destination), transitionLabel(transition),
+		)
+	}
+
+	if len(current) > 0 {
+		b.WriteString("\tclassDef current fill:lightblue\n")
+
+		for _, state := range m.sortedStates(current) {
+			if len(state.children) == 0 {
+				fmt.Fprintf(b, "\tclass %v current\n", diagramID(state))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func writeMermaidState(b *strings.Builder, state *State, indent string) {
+	id := diagramID(state)
+
+	if state.history != NoHistory {
+		fmt.Fprintf(b, "%vstate \"%v\" as %v\n", indent, historyLabel(state), id)
+		return
+	}
+
+	if id != state.Name() {
+		fmt.Fprintf(b, "%vstate %v as %v\n", indent, quote(state.Name()), id)
+	}
+
+	if len(state.children) == 0 {
+		if id == state.Name() {
+			fmt.Fprintf(b, "%v%v\n", indent, id)
+		}
+
+		return
+	}
+
+	fmt.Fprintf(b, "%vstate %v {\n", indent, id)
+
+	if state.initialChild != nil {
+		fmt.Fprintf(b, "%v\t[*] --> %v\n", indent, diagramID(state.initialChild))
+	}
+
+	for i, child := range diagramChildren(state) {
+		// regions of a parallel state are separated so they render side by side
+		if state.parallel && i > 0 && child.history == NoHistory {
+			fmt.Fprintf(b, "%v\t--\n", indent)
+		}
+
+		writeMermaidState(b, child, indent+"\t")
+	}
+
+	fmt.Fprintf(b, "%v}\n", indent)
+}
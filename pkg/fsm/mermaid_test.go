@@ -0,0 +1,74 @@
+package fsm
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExportMermaid(t *testing.T) {
+	m := newDiagramMachine(t)
+
+	require.Equal(
+		t,
+		`---
+title: fsm
+---
+stateDiagram-v2
+	[*] --> state_a
+	state_a
+	state state_b {
+		[*] --> state_b_1
+		state_b_1
+		state_b_2
+		state "H" as state_b_history
+	}
+	state_c
+	state_a --> state_b : transition_a_b (start)
+	state_a --> state_a : transition_a_a
+	state_b_1 --> state_b_2 : transition_b_next
+	state_b --> state_c : transition_b_c [guarded]
+	state_c --> state_b_history : transition_c_b
+	classDef current fill:lightblue
+	class state_b_1 current
+`,
+		ExportMermaid(m),
+	)
+
+	require.NotContains(t, ExportMermaid(m, WithCurrentState(false)), "current")
+}
+
+func TestExportMermaidRegions(t *testing.T) {
+	stateA1 := NewState("state a 1", nil, nil)
+	stateA := NewState("state_a", nil, nil, WithChildren(stateA1))
+	stateB1 := NewState("state_b_1", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1))
+	stateP := NewState("state_p", nil, nil, WithRegions(stateA, stateB))
+
+	m, err := NewMachine([]*State{stateP}, nil, stateP)
+	require.NoError(t, err)
+
+	require.Equal(
+		t,
+		`---
+title: fsm
+---
+stateDiagram-v2
+	[*] --> state_p
+	state state_p {
+		state state_a {
+			[*] --> state_a_1
+			state "state a 1" as state_a_1
+		}
+		--
+		state state_b {
+			[*] --> state_b_1
+			state_b_1
+		}
+	}
+	classDef current fill:lightblue
+	class state_a_1 current
+	class state_b_1 current
+`,
+		ExportMermaid(m),
+	)
+}
@@ -0,0 +1,63 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+)
+
+type CallbackKind int
+
+const (
+	StateEnterCallback CallbackKind = iota
+	StateExitCallback
+	TransitionEnterCallback
+	TransitionExitCallback
+)
+
+func (k CallbackKind) String() string {
+	switch k {
+	case StateEnterCallback:
+		return "state enter"
+	case StateExitCallback:
+		return "state exit"
+	case TransitionEnterCallback:
+		return "transition enter"
+	case TransitionExitCallback:
+		return "transition exit"
+	default:
+		return fmt.Sprintf("callback kind %d", int(k))
+	}
+}
+
+type Middleware func(kind CallbackKind, next Callback) Callback
+
+func WithMiddleware(middleware ...Middleware) MachineOption {
+	return func(m *Machine) error {
+		for _, mw := range middleware {
+			if mw == nil {
+				return errorf(ErrInvalidOption, "middleware must not be nil")
+			}
+		}
+
+		m.middleware = append(m.middleware, middleware...)
+
+		return nil
+	}
+}
+
+func (m *Machine) invoke(kind CallbackKind, callback Callback, scope Scope) (ctx context.Context, err error) {
+	if callback == nil {
+		return scope.Context, nil
+	}
+
+	// the first middleware registered is the outermost
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		callback = m.middleware[i](kind, callback)
+	}
+
+	if m.recoverPanics {
+		defer m.recoverPanic(kind, scope, &err)
+	}
+
+	return callback(scope)
+}
@@ -0,0 +1,106 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMachineMiddleware(t *testing.T) {
+	calls := make([]string, 0)
+
+	callback := func(scope Scope) (context.Context, error) {
+		calls = append(calls, "callback")
+		return scope.Context, nil
+	}
+
+	stateA := NewState("state_a", callback, callback)
+	stateB := NewState("state_b", callback, nil)
+
+	newMiddleware := func(name string) Middleware {
+		return func(kind CallbackKind, next Callback) Callback {
+			return func(scope Scope) (context.Context, error) {
+				subject := scope.State
+				if subject == "" {
+					subject = scope.Transition
+				}
+
+				calls = append(calls, fmt.Sprintf("%v %v %v", name, kind, subject))
+
+				return next(scope)
+			}
+		}
+	}
+
+	rejectTransitionExit := func(kind CallbackKind, next Callback) Callback {
+		if kind != TransitionExitCallback {
+			return next
+		}
+
+		return func(scope Scope) (context.Context, error) {
+			if scope.Transition == "transition_b_a" {
+				return nil, fmt.Errorf("rejected")
+			}
+
+			return next(scope)
+		}
+	}
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, callback, callback),
+			NewTransition("transition_b_a", stateB, stateA, nil, callback),
+		},
+		stateA,
+		WithMiddleware(newMiddleware("outer"), newMiddleware("inner")),
+		WithMiddleware(rejectTransitionExit),
+	)
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]string{
+			"outer transition enter transition_a_b",
+			"inner transition enter transition_a_b",
+			"callback",
+			"outer state exit state_a",
+			"inner state exit state_a",
+			"callback",
+			"outer state enter state_b",
+			"inner state enter state_b",
+			"callback",
+			"outer transition exit transition_a_b",
+			"inner transition exit transition_a_b",
+			"callback",
+		},
+		calls,
+	)
+
+	calls = make([]string, 0)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.EqualError(
+		t,
+		err,
+		`transition exit failed during transition "transition_b_a" from "state_b" to "state_a": rejected`,
+	)
+	require.Equal(t, "state_b", m.State())
+	require.Equal(
+		t,
+		[]string{
+			"outer state enter state_a",
+			"inner state enter state_a",
+			"callback",
+			"outer transition exit transition_b_a",
+			"inner transition exit transition_b_a",
+		},
+		calls,
+	)
+
+	_, err = NewMachine([]*State{stateA}, nil, stateA, WithMiddleware(nil))
+	require.Error(t, err)
+}
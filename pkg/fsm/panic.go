@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+type CallbackPanicError struct {
+	Kind       CallbackKind
+	Transition string
+	State      string
+	Value      any
+	Stack      []byte
+}
+
+func (e *CallbackPanicError) Error() string {
+	subject := fmt.Sprintf("transition %#+v", e.Transition)
+	if e.Kind == StateEnterCallback || e.Kind == StateExitCallback {
+		subject = fmt.Sprintf("state %#+v", e.State)
+	}
+
+	return fmt.Sprintf("%v callback for %v panicked: %v", e.Kind, subject, e.Value)
+}
+
+func (e *CallbackPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+
+	return err
+}
+
+func WithPanicRecovery() MachineOption {
+	return func(m *Machine) error {
+		m.recoverPanics = true
+
+		return nil
+	}
+}
+
+func (m *Machine) recoverPanic(kind CallbackKind, scope Scope, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	*err = &CallbackPanicError{
+		Kind:       kind,
+		Transition: scope.Transition,
+		State:      scope.State,
+		Value:      value,
+		Stack:      debug.Stack(),
+	}
+}
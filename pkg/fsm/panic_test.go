@@ -0,0 +1,100 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestMachinePanicRecovery(t *testing.T) {
+	errFailed := fmt.Errorf("failed")
+
+	compensated := false
+	var panicValue any
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", nil, nil)
+		stateB := NewState(
+			"state_b",
+			func(scope Scope) (context.Context, error) {
+				_ = scope.Context.Value("model").(string)
+				return scope.Context, nil
+			},
+			nil,
+		)
+		stateC := NewState("state_c", nil, nil)
+
+		return NewMachine(
+			[]*State{stateA, stateB, stateC},
+			[]*Transition{
+				NewTransition(
+					"transition_a_b",
+					stateA,
+					stateB,
+					func(scope Scope) (context.Context, error) {
+						scope.Compensate(func(ctx context.Context) error {
+							compensated = true
+							return nil
+						})
+
+						return scope.Context, nil
+					},
+					nil,
+				),
+				NewTransition(
+					"transition_a_c",
+					stateA,
+					stateC,
+					nil,
+					func(scope Scope) (context.Context, error) {
+						panic(panicValue)
+					},
+				),
+			},
+			stateA,
+			opts...,
+		)
+	}
+
+	m, err := newMachine(WithPanicRecovery())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.Error(t, err)
+	require.True(t, compensated)
+	require.Equal(t, "state_a", m.State())
+
+	callbackPanicError := &CallbackPanicError{}
+	require.True(t, errors.As(err, &callbackPanicError))
+	require.Equal(t, StateEnterCallback, callbackPanicError.Kind)
+	require.Equal(t, "transition_a_b", callbackPanicError.Transition)
+	require.Equal(t, "state_b", callbackPanicError.State)
+	require.True(t, strings.HasPrefix(callbackPanicError.Error(), `state enter callback for state "state_b" panicked: `))
+	require.Contains(t, string(callbackPanicError.Stack), "panic_test.go")
+
+	panicValue = errFailed
+	_, err = m.Transition("transition_a_c", context.Background())
+	require.ErrorIs(t, err, errFailed)
+	require.EqualError(
+		t,
+		err,
+		`transition exit failed during transition "transition_a_c" from "state_a" to "state_c": `+
+			`transition exit callback for transition "transition_a_c" panicked: failed`,
+	)
+	require.Equal(t, "state_a", m.State())
+
+	ctx := context.WithValue(context.Background(), "model", "ACME Charger 1")
+	_, err = m.Transition("transition_a_b", ctx)
+	require.NoError(t, err)
+	require.Equal(t, "state_b", m.State())
+
+	m, err = newMachine()
+	require.NoError(t, err)
+
+	require.Panics(t, func() {
+		_, _ = m.Transition("transition_a_b", context.Background())
+	})
+}
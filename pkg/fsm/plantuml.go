@@ -0,0 +1,86 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ExportPlantUML(m *Machine, opts ...ExportOption) string {
+	o := newExportOptions(opts)
+
+	current := make(stateSet)
+	if o.currentState {
+		current = m.currentStates()
+	}
+
+	b := new(strings.Builder)
+
+	fmt.Fprintf(b, "@startuml %v\n", nonIdentifierPattern.ReplaceAllString(o.name, "_"))
+	b.WriteString("hide empty description\n")
+	fmt.Fprintf(b, "[*] --> %v\n", diagramID(m.initialState))
+
+	for _, state := range m.topLevelStates() {
+		writePlantUMLState(b, state, current, "")
+	}
+
+	for _, transition := range m.transitions {
+		fmt.Fprintf(
+			b,
+			"%v --> %v : %v\n",
+			diagramID(transition.source), plantUMLTarget(transition.destination), transitionLabel(transition),
+		)
+	}
+
+	b.WriteString("@enduml\n")
+
+	return b.String()
+}
+
+func plantUMLTarget(state *State) string {
+	// history is a pseudo-state of its parent rather than a state in its own right
+	if state.history == DeepHistory {
+		return diagramID(state.parent) + "[H*]"
+	}
+
+	if state.history == ShallowHistory {
+		return diagramID(state.parent) + "[H]"
+	}
+
+	return diagramID(state)
+}
+
+func writePlantUMLState(b *strings.Builder, state *State, current stateSet, indent string) {
+	if state.history != NoHistory {
+		return
+	}
+
+	declaration := fmt.Sprintf("%vstate %v", indent, diagramID(state))
+	if diagramID(state) != state.Name() {
+		declaration = fmt.Sprintf("%vstate %v as %v", indent, quote(state.Name()), diagramID(state))
+	}
+
+	if current[state] && len(state.children) == 0 {
+		declaration += " #lightblue"
+	}
+
+	if len(state.children) == 0 {
+		fmt.Fprintf(b, "%v\n", declaration)
+		return
+	}
+
+	fmt.Fprintf(b, "%v {\n", declaration)
+
+	if state.initialChild != nil {
+		fmt.Fprintf(b, "%v\t[*] --> %v\n", indent, diagramID(state.initialChild))
+	}
+
+	for i, child := range state.children {
+		if state.parallel && i > 0 {
+			fmt.Fprintf(b, "%v\t--\n", indent)
+		}
+
+		writePlantUMLState(b, child, current, indent+"\t")
+	}
+
+	fmt.Fprintf(b, "%v}\n", indent)
+}
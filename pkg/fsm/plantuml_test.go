@@ -0,0 +1,34 @@
+package fsm
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExportPlantUML(t *testing.T) {
+	m := newDiagramMachine(t)
+
+	require.Equal(
+		t,
+		`@startuml fsm
+hide empty description
+[*] --> state_a
+state state_a
+state state_b {
+	[*] --> state_b_1
+	state state_b_1 #lightblue
+	state state_b_2
+}
+state state_c
+state_a --> state_b : transition_a_b (start)
+state_a --> state_a : transition_a_a
+state_b_1 --> state_b_2 : transition_b_next
+state_b --> state_c : transition_b_c [guarded]
+state_c --> state_b[H] : transition_c_b
+@enduml
+`,
+		ExportPlantUML(m),
+	)
+
+	require.Contains(t, ExportPlantUML(m, WithDiagramName("charging station")), "@startuml charging_station\n")
+}
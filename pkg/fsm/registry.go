@@ -0,0 +1,55 @@
+package fsm
+
+type Registry struct {
+	callbackByName map[string]Callback
+	guardByName    map[string]Guard
+}
+
+func NewRegistry() *Registry {
+	r := Registry{
+		callbackByName: make(map[string]Callback),
+		guardByName:    make(map[string]Guard),
+	}
+
+	return &r
+}
+
+func (r *Registry) RegisterCallback(name string, callback Callback) error {
+	if callback == nil {
+		return errorf(ErrInvalidDefinition, "callback %#+v must not be nil", name)
+	}
+
+	_, ok := r.callbackByName[name]
+	if ok {
+		return errorf(ErrInvalidDefinition, "callback %#+v already registered", name)
+	}
+
+	r.callbackByName[name] = callback
+
+	return nil
+}
+
+func (r *Registry) RegisterGuard(name string, guard Guard) error {
+	if guard == nil {
+		return errorf(ErrInvalidDefinition, "guard %#+v must not be nil", name)
+	}
+
+	_, ok := r.guardByName[name]
+	if ok {
+		return errorf(ErrInvalidDefinition, "guard %#+v already registered", name)
+	}
+
+	r.guardByName[name] = guard
+
+	return nil
+}
+
+func (r *Registry) GetCallback(name string) (Callback, bool) {
+	callback, ok := r.callbackByName[name]
+	return callback, ok
+}
+
+func (r *Registry) GetGuard(name string) (Guard, bool) {
+	guard, ok := r.guardByName[name]
+	return guard, ok
+}
@@ -0,0 +1,495 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	scxmlNamespace = "http://www.w3.org/2005/07/scxml"
+	statoNamespace = "https://github.com/initialed85/stato"
+)
+
+type scxmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr  `xml:",any,attr"`
+	Children []scxmlNode `xml:",any"`
+	Text     string      `xml:",chardata"`
+}
+
+func (n scxmlNode) attr(space string, local string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == local && attr.Name.Space == space {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+
+	return ""
+}
+
+func (n scxmlNode) is(space string, local string) bool {
+	return n.XMLName.Space == space && n.XMLName.Local == local
+}
+
+func (n scxmlNode) describe() string {
+	id := n.attr("", "id")
+	if id == "" {
+		return fmt.Sprintf("<%v>", n.XMLName.Local)
+	}
+
+	return fmt.Sprintf("<%v id=%#+v>", n.XMLName.Local, id)
+}
+
+// attributes from other vocabularies are left alone, as SCXML allows
+func scxmlAttrs(node scxmlNode, allowed ...string) error {
+	for _, attr := range node.Attrs {
+		name := attr.Name.Local
+
+		switch attr.Name.Space {
+		case "":
+			if name == "xmlns" {
+				continue
+			}
+		case statoNamespace:
+			name = "stato:" + name
+		default:
+			continue
+		}
+
+		supported := false
+		for _, allowedName := range allowed {
+			if name == allowedName {
+				supported = true
+				break
+			}
+		}
+
+		if !supported {
+			return errorf(ErrInvalidDefinition, "attribute %#+v of %v not supported", name, node.describe())
+		}
+	}
+
+	return nil
+}
+
+func scxmlDefaultTransitionName(event string, source string, destination string) string {
+	if event != "" {
+		return event
+	}
+
+	return fmt.Sprintf("%v_to_%v", source, destination)
+}
+
+func scxmlSingle(value string, what string, node scxmlNode) (string, error) {
+	if len(strings.Fields(value)) > 1 {
+		return "", errorf(ErrInvalidDefinition, "%v of %v has more than one %v", what, node.describe(), what)
+	}
+
+	return value, nil
+}
+
+func scxmlScript(node scxmlNode) (string, error) {
+	name := ""
+
+	for _, child := range node.Children {
+		if !child.is(scxmlNamespace, "script") || len(child.Children) > 0 {
+			return "", errorf(
+				ErrInvalidDefinition,
+				"%v in %v not supported, only a <script> naming a callback",
+				child.describe(), node.describe(),
+			)
+		}
+
+		err := scxmlAttrs(child)
+		if err != nil {
+			return "", err
+		}
+
+		if name != "" {
+			return "", errorf(ErrInvalidDefinition, "%v has more than one <script>", node.describe())
+		}
+
+		name = strings.TrimSpace(child.Text)
+	}
+
+	return name, nil
+}
+
+type scxmlImporter struct {
+	transitions []TransitionDefinition
+}
+
+func (i *scxmlImporter) states(parent scxmlNode) ([]StateDefinition, string, error) {
+	// left nil when empty to match definitions decoded from YAML or JSON
+	var states []StateDefinition
+	initial := ""
+
+	for _, child := range parent.Children {
+		switch {
+		case child.is(scxmlNamespace, "state"), child.is(scxmlNamespace, "parallel"), child.is(scxmlNamespace, "final"):
+			state, err := i.state(child)
+			if err != nil {
+				return nil, "", err
+			}
+
+			states = append(states, state)
+
+		case child.is(scxmlNamespace, "history"):
+			err := scxmlAttrs(child, "id", "type")
+			if err != nil {
+				return nil, "", err
+			}
+
+			if len(child.Children) > 0 {
+				return nil, "", errorf(ErrInvalidDefinition, "default transition of %v not supported", child.describe())
+			}
+
+			history := child.attr("", "type")
+			if history == "" {
+				history = shallowHistoryDefinition
+			}
+
+			states = append(states, StateDefinition{Name: child.attr("", "id"), History: history})
+
+		case child.is(scxmlNamespace, "initial"):
+			err := scxmlAttrs(child)
+			if err != nil {
+				return nil, "", err
+			}
+
+			if len(child.Children) != 1 || !child.Children[0].is(scxmlNamespace, "transition") {
+				return nil, "", errorf(ErrInvalidDefinition, "<initial> of %v must hold a single <transition>", parent.describe())
+			}
+
+			target, err := scxmlSingle(child.Children[0].attr("", "target"), "target", child)
+			if err != nil {
+				return nil, "", err
+			}
+
+			initial = target
+		}
+	}
+
+	return states, initial, nil
+}
+
+func (i *scxmlImporter) state(node scxmlNode) (StateDefinition, error) {
+	state := StateDefinition{
+		Name:     node.attr("", "id"),
+		Parallel: node.is(scxmlNamespace, "parallel"),
+	}
+
+	if state.Name == "" {
+		return state, errorf(ErrInvalidDefinition, "%v without an id not supported", node.describe())
+	}
+
+	err := scxmlAttrs(node, "id", "initial")
+	if err != nil {
+		return state, err
+	}
+
+	initial, err := scxmlSingle(node.attr("", "initial"), "initial", node)
+	if err != nil {
+		return state, err
+	}
+
+	states, initialElement, err := i.states(node)
+	if err != nil {
+		return state, err
+	}
+
+	state.States = states
+
+	state.Initial = initial
+	if initialElement != "" {
+		state.Initial = initialElement
+	}
+
+	for _, child := range node.Children {
+		switch {
+		case child.is(scxmlNamespace, "state"), child.is(scxmlNamespace, "parallel"), child.is(scxmlNamespace, "final"),
+			child.is(scxmlNamespace, "history"), child.is(scxmlNamespace, "initial"):
+			continue
+
+		case child.is(scxmlNamespace, "onentry"):
+			err = scxmlAttrs(child)
+			if err != nil {
+				return state, err
+			}
+
+			state.OnEnter, err = scxmlScript(child)
+			if err != nil {
+				return state, err
+			}
+
+		case child.is(scxmlNamespace, "onexit"):
+			err = scxmlAttrs(child)
+			if err != nil {
+				return state, err
+			}
+
+			state.OnExit, err = scxmlScript(child)
+			if err != nil {
+				return state, err
+			}
+
+		case child.is(scxmlNamespace, "transition"):
+			err = i.transition(state.Name, child)
+			if err != nil {
+				return state, err
+			}
+
+		case child.is(statoNamespace, "timeout"):
+			err = scxmlAttrs(child, "after", "transition")
+			if err != nil {
+				return state, err
+			}
+
+			state.Timeouts = append(state.Timeouts, TimeoutDefinition{
+				After:      child.attr("", "after"),
+				Transition: child.attr("", "transition"),
+			})
+
+		default:
+			return state, errorf(ErrInvalidDefinition, "%v in %v not supported", child.describe(), node.describe())
+		}
+	}
+
+	return state, nil
+}
+
+func (i *scxmlImporter) transition(source string, node scxmlNode) error {
+	err := scxmlAttrs(node, "event", "cond", "target", "type", "stato:name", "stato:on_exit")
+	if err != nil {
+		return err
+	}
+
+	// the machine only has external transitions
+	transitionType := node.attr("", "type")
+	if transitionType != "" && transitionType != "external" {
+		return errorf(ErrInvalidDefinition, "<transition> type %#+v from %#+v not supported", transitionType, source)
+	}
+
+	event, err := scxmlSingle(node.attr("", "event"), "event", node)
+	if err != nil {
+		return err
+	}
+
+	// events are matched by name, not by SCXML's dotted prefix descriptors
+	if strings.ContainsAny(event, ".*") {
+		return errorf(ErrInvalidDefinition, "<transition> event descriptor %#+v from %#+v not supported", event, source)
+	}
+
+	destination, err := scxmlSingle(node.attr("", "target"), "target", node)
+	if err != nil {
+		return err
+	}
+
+	if destination == "" {
+		return errorf(ErrInvalidDefinition, "<transition> from %#+v without a target not supported", source)
+	}
+
+	onEnter, err := scxmlScript(node)
+	if err != nil {
+		return err
+	}
+
+	name := node.attr(statoNamespace, "name")
+	if name == "" {
+		name = scxmlDefaultTransitionName(event, source, destination)
+	}
+
+	i.transitions = append(i.transitions, TransitionDefinition{
+		Name:        name,
+		Source:      source,
+		Destination: destination,
+		Event:       event,
+		Guard:       node.attr("", "cond"),
+		OnEnter:     onEnter,
+		OnExit:      node.attr(statoNamespace, "on_exit"),
+	})
+
+	return nil
+}
+
+func UnmarshalSCXML(data []byte) (Definition, error) {
+	definition := Definition{}
+
+	root := scxmlNode{}
+
+	err := xml.Unmarshal(data, &root)
+	if err != nil {
+		return definition, errorf(ErrInvalidDefinition, "failed to unmarshal scxml: %v", err)
+	}
+
+	if !root.is(scxmlNamespace, "scxml") {
+		return definition, errorf(ErrInvalidDefinition, "root element %v not <scxml>", root.describe())
+	}
+
+	err = scxmlAttrs(root, "version", "initial", "name")
+	if err != nil {
+		return definition, err
+	}
+
+	for _, child := range root.Children {
+		if !(child.is(scxmlNamespace, "state") || child.is(scxmlNamespace, "parallel") || child.is(scxmlNamespace, "final")) {
+			return definition, errorf(ErrInvalidDefinition, "%v in <scxml> not supported", child.describe())
+		}
+	}
+
+	i := scxmlImporter{}
+
+	states, _, err := i.states(root)
+	if err != nil {
+		return definition, err
+	}
+
+	definition.States = states
+	definition.Transitions = i.transitions
+
+	definition.Initial, err = scxmlSingle(root.attr("", "initial"), "initial", root)
+	if err != nil {
+		return definition, err
+	}
+
+	// as in SCXML, the first state in document order is the initial state unless one is named
+	if definition.Initial == "" && len(states) > 0 {
+		definition.Initial = states[0].Name
+	}
+
+	return definition, nil
+}
+
+type scxmlExporter struct {
+	b                   *bytes.Buffer
+	transitionsBySource map[string][]TransitionDefinition
+	exported            map[string]bool
+}
+
+func (e *scxmlExporter) escape(s string) string {
+	b := new(bytes.Buffer)
+	_ = xml.EscapeText(b, []byte(s))
+
+	return b.String()
+}
+
+func (e *scxmlExporter) script(indent string, element string, name string) {
+	if name == "" {
+		return
+	}
+
+	fmt.Fprintf(e.b, "%v<%v><script>%v</script></%v>\n", indent, element, e.escape(name), element)
+}
+
+func (e *scxmlExporter) state(state StateDefinition, indent string) {
+	if state.History != "" {
+		fmt.Fprintf(e.b, "%v<history id=\"%v\" type=\"%v\"/>\n", indent, e.escape(state.Name), e.escape(state.History))
+		return
+	}
+
+	element := "state"
+	if state.Parallel {
+		element = "parallel"
+	}
+
+	fmt.Fprintf(e.b, "%v<%v id=\"%v\"", indent, element, e.escape(state.Name))
+
+	if state.Initial != "" {
+		fmt.Fprintf(e.b, " initial=\"%v\"", e.escape(state.Initial))
+	}
+
+	transitions := e.transitionsBySource[state.Name]
+	e.exported[state.Name] = true
+
+	if state.OnEnter == "" && state.OnExit == "" && len(state.Timeouts) == 0 && len(state.States) == 0 && len(transitions) == 0 {
+		e.b.WriteString("/>\n")
+		return
+	}
+
+	e.b.WriteString(">\n")
+
+	e.script(indent+"\t", "onentry", state.OnEnter)
+	e.script(indent+"\t", "onexit", state.OnExit)
+
+	for _, timeout := range state.Timeouts {
+		fmt.Fprintf(
+			e.b,
+			"%v\t<stato:timeout after=\"%v\" transition=\"%v\"/>\n",
+			indent, e.escape(timeout.After), e.escape(timeout.Transition),
+		)
+	}
+
+	for _, transition := range transitions {
+		fmt.Fprintf(e.b, "%v\t<transition", indent)
+
+		if transition.Event != "" {
+			fmt.Fprintf(e.b, " event=\"%v\"", e.escape(transition.Event))
+		}
+
+		if transition.Guard != "" {
+			fmt.Fprintf(e.b, " cond=\"%v\"", e.escape(transition.Guard))
+		}
+
+		fmt.Fprintf(e.b, " target=\"%v\"", e.escape(transition.Destination))
+
+		if transition.Name != scxmlDefaultTransitionName(transition.Event, transition.Source, transition.Destination) {
+			fmt.Fprintf(e.b, " stato:name=\"%v\"", e.escape(transition.Name))
+		}
+
+		if transition.OnExit != "" {
+			fmt.Fprintf(e.b, " stato:on_exit=\"%v\"", e.escape(transition.OnExit))
+		}
+
+		if transition.OnEnter == "" {
+			e.b.WriteString("/>\n")
+		} else {
+			fmt.Fprintf(e.b, "><script>%v</script></transition>\n", e.escape(transition.OnEnter))
+		}
+	}
+
+	for _, child := range state.States {
+		e.state(child, indent+"\t")
+	}
+
+	fmt.Fprintf(e.b, "%v</%v>\n", indent, element)
+}
+
+func MarshalSCXML(definition Definition) ([]byte, error) {
+	e := scxmlExporter{
+		b:                   new(bytes.Buffer),
+		transitionsBySource: make(map[string][]TransitionDefinition),
+		exported:            make(map[string]bool),
+	}
+
+	for _, transition := range definition.Transitions {
+		e.transitionsBySource[transition.Source] = append(e.transitionsBySource[transition.Source], transition)
+	}
+
+	e.b.WriteString(xml.Header)
+	fmt.Fprintf(
+		e.b,
+		"<scxml xmlns=\"%v\" xmlns:stato=\"%v\" version=\"1.0\" initial=\"%v\">\n",
+		scxmlNamespace, statoNamespace, e.escape(definition.Initial),
+	)
+
+	for _, state := range definition.States {
+		e.state(state, "\t")
+	}
+
+	e.b.WriteString("</scxml>\n")
+
+	// transitions are nested in their source so one from an unknown state would otherwise be lost
+	for _, transition := range definition.Transitions {
+		if !e.exported[transition.Source] {
+			return nil, errorf(
+				ErrUnknownState,
+				"transition %#+v source %#+v not in states",
+				transition.Name, transition.Source,
+			)
+		}
+	}
+
+	return e.b.Bytes(), nil
+}
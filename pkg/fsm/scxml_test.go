@@ -0,0 +1,207 @@
+package fsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUnmarshalSCXML(t *testing.T) {
+	for _, testCase := range []struct {
+		name       string
+		scxml      string
+		definition Definition
+	}{
+		{
+			name: "atomic states with event, cond and target",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="b">
+	<state id="a">
+		<transition event="go" cond="ready" target="b" type="external"/>
+	</state>
+	<state id="b">
+		<transition target="a"/>
+	</state>
+</scxml>`,
+			definition: Definition{
+				Initial: "b",
+				States:  []StateDefinition{{Name: "a"}, {Name: "b"}},
+				Transitions: []TransitionDefinition{
+					{Name: "go", Source: "a", Destination: "b", Event: "go", Guard: "ready"},
+					{Name: "b_to_a", Source: "b", Destination: "a"},
+				},
+			},
+		},
+		{
+			name: "first state is the initial state by default",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0">
+	<state id="a"/>
+	<final id="b"/>
+</scxml>`,
+			definition: Definition{
+				Initial: "a",
+				States:  []StateDefinition{{Name: "a"}, {Name: "b"}},
+			},
+		},
+		{
+			name: "onentry, onexit and transition scripts name callbacks",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:stato="https://github.com/initialed85/stato" version="1.0">
+	<state id="a">
+		<onentry><script>on_a</script></onentry>
+		<onexit><script> off_a </script></onexit>
+		<transition event="go" target="b" stato:name="a_b" stato:on_exit="after_a_b"><script>before_a_b</script></transition>
+	</state>
+	<state id="b"/>
+</scxml>`,
+			definition: Definition{
+				Initial: "a",
+				States:  []StateDefinition{{Name: "a", OnEnter: "on_a", OnExit: "off_a"}, {Name: "b"}},
+				Transitions: []TransitionDefinition{
+					{Name: "a_b", Source: "a", Destination: "b", Event: "go", OnEnter: "before_a_b", OnExit: "after_a_b"},
+				},
+			},
+		},
+		{
+			name: "compound, parallel and history states",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:stato="https://github.com/initialed85/stato" version="1.0">
+	<state id="a">
+		<initial><transition target="a_2"/></initial>
+		<state id="a_1"/>
+		<state id="a_2">
+			<stato:timeout after="2m" transition="leave"/>
+		</state>
+		<history id="a_history" type="deep"/>
+		<transition event="leave" target="p"/>
+	</state>
+	<parallel id="p">
+		<state id="r_1"/>
+		<state id="r_2"/>
+		<history id="p_history"/>
+	</parallel>
+</scxml>`,
+			definition: Definition{
+				Initial: "a",
+				States: []StateDefinition{
+					{
+						Name:    "a",
+						Initial: "a_2",
+						States: []StateDefinition{
+							{Name: "a_1"},
+							{Name: "a_2", Timeouts: []TimeoutDefinition{{After: "2m", Transition: "leave"}}},
+							{Name: "a_history", History: "deep"},
+						},
+					},
+					{
+						Name:     "p",
+						Parallel: true,
+						States: []StateDefinition{
+							{Name: "r_1"},
+							{Name: "r_2"},
+							{Name: "p_history", History: "shallow"},
+						},
+					},
+				},
+				Transitions: []TransitionDefinition{
+					{Name: "leave", Source: "a", Destination: "p", Event: "leave"},
+				},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			definition, err := UnmarshalSCXML([]byte(testCase.scxml))
+			require.NoError(t, err)
+			require.Equal(t, testCase.definition, definition)
+
+			registry := NewRegistry()
+
+			for _, name := range []string{"on_a", "off_a", "before_a_b", "after_a_b"} {
+				err = registry.RegisterCallback(name, func(scope Scope) (context.Context, error) {
+					return scope.Context, nil
+				})
+				require.NoError(t, err)
+			}
+
+			err = registry.RegisterGuard("ready", func(scope Scope) bool {
+				return true
+			})
+			require.NoError(t, err)
+
+			_, err = NewMachineFromDefinition(definition, registry)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestUnmarshalSCXMLUnsupported(t *testing.T) {
+	for _, scxml := range []string{
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"></scxml>`,
+		`<machine><state id="a"/></machine>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><datamodel/><state id="a"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><invoke/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><onentry><log expr="1"/></onentry></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><onentry><script>x</script><script>y</script></onentry></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition event="go"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition event="go stop" target="a"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition target="a b"/></state><state id="b"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="a b"><state id="a"/><state id="b"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><state id="a_1"/><history id="h"><transition target="a_1"/></history></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" datamodel="ecmascript"><state id="a"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" binding="late"><state id="a"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a" src="a.scxml"/></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition type="internal" event="go" target="a"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition event="go.*" target="a"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition event="go.started" target="a"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><transition event="*" target="a"/></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0"><state id="a"><onentry><script src="on_a.js"/></onentry></state></scxml>`,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:stato="https://github.com/initialed85/stato" version="1.0"><state id="a"><stato:timeout after="1s" transition="go" every="1s"/></state></scxml>`,
+	} {
+		_, err := UnmarshalSCXML([]byte(scxml))
+		require.ErrorIs(t, err, ErrInvalidDefinition, scxml)
+	}
+}
+
+func TestMarshalSCXML(t *testing.T) {
+	definition, err := UnmarshalDefinition([]byte(connectorDefinitionYAML))
+	require.NoError(t, err)
+
+	scxml, err := MarshalSCXML(definition)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		`<?xml version="1.0" encoding="UTF-8"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:stato="https://github.com/initialed85/stato" version="1.0" initial="available">
+	<state id="available">
+		<onentry><script>log</script></onentry>
+		<transition target="preparing" stato:name="plug_in"/>
+	</state>
+	<state id="occupied" initial="preparing">
+		<transition target="faulted" stato:name="fault"/>
+		<state id="preparing">
+			<onentry><script>log</script></onentry>
+			<stato:timeout after="2m" transition="expire"/>
+			<transition event="remote_start" cond="no_transaction" target="charging"><script>start_transaction</script></transition>
+			<transition event="expire" target="available"/>
+		</state>
+		<state id="charging">
+			<onentry><script>log</script></onentry>
+		</state>
+		<history id="occupied_history" type="shallow"/>
+	</state>
+	<state id="faulted">
+		<transition target="occupied_history" stato:name="resume"/>
+	</state>
+</scxml>
+`,
+		string(scxml),
+	)
+
+	roundTripped, err := UnmarshalSCXML(scxml)
+	require.NoError(t, err)
+	require.Equal(t, definition.Initial, roundTripped.Initial)
+	require.Equal(t, definition.States, roundTripped.States)
+	require.ElementsMatch(t, definition.Transitions, roundTripped.Transitions)
+
+	definition.Transitions = append(definition.Transitions, TransitionDefinition{Name: "lost", Source: "missing", Destination: "available"})
+	_, err = MarshalSCXML(definition)
+	require.ErrorIs(t, err, ErrUnknownState)
+}
@@ -0,0 +1,252 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type TimerSnapshot struct {
+	State      string    `json:"state"`
+	Transition string    `json:"transition"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+type Snapshot struct {
+	State         string              `json:"state"`
+	Configuration []string            `json:"configuration"`
+	History       map[string][]string `json:"history,omitempty"`
+	Timers        []TimerSnapshot     `json:"timers,omitempty"`
+	Transition    string              `json:"transition,omitempty"`
+	Timestamp     time.Time           `json:"timestamp"`
+	Version       int64               `json:"version"`
+}
+
+func (s Snapshot) copy() Snapshot {
+	s.Configuration = append([]string{}, s.Configuration...)
+
+	history := make(map[string][]string)
+	for state, leaves := range s.History {
+		history[state] = append([]string{}, leaves...)
+	}
+	s.History = history
+
+	s.Timers = append([]TimerSnapshot{}, s.Timers...)
+
+	return s
+}
+
+func (m *Machine) buildSnapshot() Snapshot {
+	configuration := make([]string, 0)
+	for _, state := range m.leaves() {
+		configuration = append(configuration, state.Name())
+	}
+
+	history := make(map[string][]string)
+	for state, leaves := range m.historyByState {
+		for _, leaf := range leaves {
+			history[state.Name()] = append(history[state.Name()], leaf.Name())
+		}
+	}
+
+	timers := make([]TimerSnapshot, 0)
+	for p := range m.timers {
+		timers = append(timers, TimerSnapshot{
+			State:      p.state.Name(),
+			Transition: p.timeout.transition,
+			Deadline:   p.deadline,
+		})
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		if !timers[i].Deadline.Equal(timers[j].Deadline) {
+			return timers[i].Deadline.Before(timers[j].Deadline)
+		}
+
+		if timers[i].State != timers[j].State {
+			return timers[i].State < timers[j].State
+		}
+
+		return timers[i].Transition < timers[j].Transition
+	})
+
+	return Snapshot{
+		State:         strings.Join(configuration, ","),
+		Configuration: configuration,
+		History:       history,
+		Timers:        timers,
+		Transition:    m.lastTransition,
+		Timestamp:     m.lastTimestamp,
+		Version:       m.version,
+	}
+}
+
+func (m *Machine) publish() {
+	snapshot := m.buildSnapshot()
+	m.snapshot.Store(&snapshot)
+}
+
+func (m *Machine) Snapshot() Snapshot {
+	return m.snapshot.Load().copy()
+}
+
+func WithRestoredState(snapshot Snapshot) MachineOption {
+	return func(m *Machine) error {
+		snapshot = snapshot.copy()
+		m.restoredSnapshot = &snapshot
+
+		return nil
+	}
+}
+
+func (m *Machine) getStates(names []string) ([]*State, error) {
+	states := make([]*State, 0)
+
+	for _, name := range names {
+		state, ok := m.stateByName[name]
+		if !ok {
+			return nil, errorf(ErrInvalidSnapshot, "state %#+v not known", name)
+		}
+
+		if len(state.children) > 0 || state.history != NoHistory {
+			return nil, errorf(ErrInvalidSnapshot, "state %#+v not an atomic state", name)
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func (m *Machine) restore(snapshot Snapshot) error {
+	leaves, err := m.getStates(snapshot.Configuration)
+	if err != nil {
+		return fmt.Errorf("failed to restore configuration: %w", err)
+	}
+
+	if len(leaves) == 0 {
+		return errorf(ErrInvalidSnapshot, "failed to restore configuration: no states")
+	}
+
+	active := make(stateSet)
+	for _, leaf := range leaves {
+		for state := leaf; state != nil; state = state.parent {
+			active[state] = true
+		}
+	}
+
+	for state := range active {
+		activeChildren := 0
+		for _, child := range state.children {
+			if active[child] {
+				activeChildren++
+			}
+		}
+
+		if state.parent == nil {
+			for _, other := range m.stateByName {
+				if other != state && other.parent == nil && active[other] {
+					return errorf(
+						ErrInvalidSnapshot,
+						"failed to restore configuration: states %#+v and %#+v both active",
+						state.Name(), other.Name(),
+					)
+				}
+			}
+		}
+
+		if len(state.children) == 0 {
+			continue
+		}
+
+		if state.parallel && activeChildren != len(state.children) {
+			return errorf(
+				ErrInvalidSnapshot,
+				"failed to restore configuration: not every region of %#+v active",
+				state.Name(),
+			)
+		}
+
+		if !state.parallel && activeChildren != 1 {
+			return errorf(
+				ErrInvalidSnapshot,
+				"failed to restore configuration: %v children of %#+v active, expected exactly one",
+				activeChildren, state.Name(),
+			)
+		}
+	}
+
+	historyByState := make(map[*State][]*State)
+	for name, leafNames := range snapshot.History {
+		state, ok := m.stateByName[name]
+		if !ok || len(state.children) == 0 {
+			return errorf(ErrInvalidSnapshot, "failed to restore history: state %#+v not a composite state", name)
+		}
+
+		historyLeaves, err := m.getStates(leafNames)
+		if err != nil {
+			return fmt.Errorf("failed to restore history of %#+v: %w", name, err)
+		}
+
+		for _, leaf := range historyLeaves {
+			if !leaf.isDescendantOf(state) {
+				return errorf(
+					ErrInvalidSnapshot,
+					"failed to restore history of %#+v: state %#+v not a descendant",
+					name, leaf.Name(),
+				)
+			}
+		}
+
+		historyByState[state] = historyLeaves
+	}
+
+	timers := make([]TimerSnapshot, 0)
+	for _, timer := range snapshot.Timers {
+		state, ok := m.stateByName[timer.State]
+		if !ok || !active[state] {
+			return errorf(ErrInvalidSnapshot, "failed to restore timer: state %#+v not active", timer.State)
+		}
+
+		found := false
+		for _, timeout := range state.timeouts {
+			if timeout.transition == timer.Transition {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errorf(
+				ErrInvalidSnapshot,
+				"failed to restore timer: state %#+v has no timeout for transition %#+v",
+				timer.State, timer.Transition,
+			)
+		}
+
+		timers = append(timers, timer)
+	}
+
+	m.active = active
+	m.historyByState = historyByState
+	m.lastTransition = snapshot.Transition
+	m.lastTimestamp = snapshot.Timestamp
+	m.version = snapshot.Version
+
+	for _, timer := range timers {
+		state := m.stateByName[timer.State]
+
+		for _, timeout := range state.timeouts {
+			if timeout.transition != timer.Transition {
+				continue
+			}
+
+			m.startTimer(state, timeout, timer.Deadline)
+
+			break
+		}
+	}
+
+	return nil
+}
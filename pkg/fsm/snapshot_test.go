@@ -0,0 +1,153 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/initialed85/stato/pkg/fsm/fsmtest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMachineRestore(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := fsmtest.NewFakeClock(start)
+
+	enterCallCount := 0
+
+	enter := func(scope Scope) (context.Context, error) {
+		enterCallCount++
+		return scope.Context, nil
+	}
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", enter, nil)
+		stateB1 := NewState("state_b_1", enter, nil)
+		stateB2 := NewState("state_b_2", enter, nil, WithTimeout(time.Second*10, "transition_b_a"))
+		stateB := NewState("state_b", enter, nil, WithChildren(stateB1, stateB2))
+		stateBHistory := NewShallowHistory("state_b_history", stateB)
+
+		return NewMachine(
+			[]*State{stateA, stateB},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, nil, nil),
+				NewTransition("transition_a_b_history", stateA, stateBHistory, nil, nil),
+				NewTransition("transition_b_next", stateB1, stateB2, nil, nil),
+				NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			},
+			stateA,
+			append([]MachineOption{WithClock(clock)}, opts...)...,
+		)
+	}
+
+	m, err := newMachine()
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_b_next", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b_history", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "state_b_2", m.State())
+
+	clock.Advance(time.Second * 4)
+
+	snapshot := m.Snapshot()
+	require.Equal(t, "state_b_2", snapshot.State)
+	require.Equal(t, []string{"state_b_2"}, snapshot.Configuration)
+	require.Equal(t, map[string][]string{"state_b": {"state_b_2"}}, snapshot.History)
+	require.Equal(
+		t,
+		[]TimerSnapshot{{State: "state_b_2", Transition: "transition_b_a", Deadline: start.Add(time.Second * 10)}},
+		snapshot.Timers,
+	)
+	require.Equal(t, "transition_a_b_history", snapshot.Transition)
+	require.Equal(t, int64(4), snapshot.Version)
+
+	data, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+
+	restoredSnapshot := Snapshot{}
+	err = json.Unmarshal(data, &restoredSnapshot)
+	require.NoError(t, err)
+
+	enterCallCount = 0
+
+	restored, err := newMachine(WithRestoredState(restoredSnapshot))
+	require.NoError(t, err)
+	require.Equal(t, 0, enterCallCount)
+	require.Equal(t, snapshot.State, restored.State())
+	require.Equal(t, snapshot.History, restored.History())
+	require.Equal(t, snapshot.Version, restored.Snapshot().Version)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	clock.Advance(time.Second * 5)
+	require.Equal(t, "state_b_2", restored.State())
+
+	clock.Advance(time.Second * 1)
+	require.Equal(t, "state_a", restored.State())
+	require.Equal(t, int64(5), restored.Snapshot().Version)
+
+	_, err = restored.Transition("transition_a_b_history", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "state_b_2", restored.State())
+
+	for _, invalidSnapshot := range []Snapshot{
+		{},
+		{Configuration: []string{"state_c"}},
+		{Configuration: []string{"state_b"}},
+		{Configuration: []string{"state_a", "state_b_1"}},
+		{Configuration: []string{"state_a"}, History: map[string][]string{"state_a": {"state_b_1"}}},
+		{Configuration: []string{"state_a"}, Timers: []TimerSnapshot{{State: "state_b_2", Transition: "transition_b_a"}}},
+	} {
+		_, err = newMachine(WithRestoredState(invalidSnapshot))
+		require.Error(t, err)
+	}
+}
+
+func TestMachineRestoreOverdueTimer(t *testing.T) {
+	newMachine := func(initialTimeout time.Duration, opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", nil, nil, WithTimeout(initialTimeout, "transition_a_b"))
+		stateB := NewState("state_b", nil, nil)
+
+		return NewMachine(
+			[]*State{stateA, stateB},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			},
+			stateA,
+			opts...,
+		)
+	}
+
+	m, err := newMachine(
+		time.Hour,
+		WithRestoredState(Snapshot{
+			State:         "state_a",
+			Configuration: []string{"state_a"},
+			Timers: []TimerSnapshot{
+				{State: "state_a", Transition: "transition_a_b", Deadline: time.Now().Add(-time.Hour)},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return m.State() == "state_b"
+	}, time.Second, time.Millisecond)
+
+	m, err = newMachine(0)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return m.State() == "state_b"
+	}, time.Second, time.Millisecond)
+}
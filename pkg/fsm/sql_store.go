@@ -0,0 +1,181 @@
+package fsm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type Placeholder int
+
+const (
+	QuestionPlaceholder Placeholder = iota // ?, e.g. SQLite and MySQL
+	DollarPlaceholder                      // $1, e.g. PostgreSQL
+)
+
+type SQLStoreOption func(*SQLStore) error
+
+func WithPlaceholder(placeholder Placeholder) SQLStoreOption {
+	return func(s *SQLStore) error {
+		if placeholder != QuestionPlaceholder && placeholder != DollarPlaceholder {
+			return errorf(ErrInvalidOption, "placeholder %#+v not known", placeholder)
+		}
+
+		s.placeholder = placeholder
+
+		return nil
+	}
+}
+
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+func NewSQLStore(
+	db *sql.DB,
+	table string,
+	opts ...SQLStoreOption,
+) (*SQLStore, error) {
+	if !tableNamePattern.MatchString(table) {
+		return nil, errorf(ErrInvalidOption, "table %#+v not a valid identifier", table)
+	}
+
+	s := SQLStore{
+		db:          db,
+		table:       table,
+		placeholder: QuestionPlaceholder,
+	}
+
+	for _, opt := range opts {
+		err := opt(&s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// query fills in the table name and rewrites each ? for the configured placeholder style
+func (s *SQLStore) query(format string) string {
+	query := fmt.Sprintf(format, s.table)
+
+	if s.placeholder != DollarPlaceholder {
+		return query
+	}
+
+	b := strings.Builder{}
+	n := 0
+
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+
+		n++
+		b.WriteString(fmt.Sprintf("$%v", n))
+	}
+
+	return b.String()
+}
+
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %v (id VARCHAR(255) PRIMARY KEY, version BIGINT NOT NULL, snapshot TEXT NOT NULL)",
+			s.table,
+		),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	snapshot := Snapshot{}
+
+	var data string
+
+	err := s.db.QueryRowContext(
+		ctx,
+		s.query("SELECT snapshot FROM %v WHERE id = ?"),
+		id,
+	).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return snapshot, fmt.Errorf("id %#+v: %w", id, ErrSnapshotNotFound)
+		}
+
+		return snapshot, err
+	}
+
+	err = json.Unmarshal([]byte(data), &snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, nil
+}
+
+func (s *SQLStore) Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion int64) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	conflict := fmt.Errorf(
+		"id %#+v not at version %v: %w",
+		id, expectedVersion, ErrVersionConflict,
+	)
+
+	if expectedVersion == 0 {
+		// a concurrent insert for the same id fails on the primary key rather than overwriting
+		_, err = s.db.ExecContext(
+			ctx,
+			s.query("INSERT INTO %v (id, version, snapshot) VALUES (?, ?, ?)"),
+			id, snapshot.Version, string(data),
+		)
+		if err != nil {
+			_, loadErr := s.Load(ctx, id)
+			if loadErr == nil {
+				return conflict
+			}
+
+			return err
+		}
+
+		return nil
+	}
+
+	result, err := s.db.ExecContext(
+		ctx,
+		s.query("UPDATE %v SET version = ?, snapshot = ? WHERE id = ? AND version = ?"),
+		snapshot.Version, string(data), id, expectedVersion,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != 1 {
+		return conflict
+	}
+
+	return nil
+}
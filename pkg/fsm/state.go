@@ -1,6 +1,51 @@
 package fsm
 
+import "fmt"
+
+type StateOption func(s *State)
+
+func WithChildren(children ...*State) StateOption {
+	return func(s *State) {
+		for _, child := range children {
+			if child.parent != nil {
+				panic(fmt.Sprintf(
+					"state %#+v already a child of %#+v",
+					child.Name(), child.parent.Name(),
+				))
+			}
+
+			child.parent = s
+			s.children = append(s.children, child)
+		}
+
+		if s.initialChild == nil && len(s.children) > 0 {
+			s.initialChild = s.children[0]
+		}
+	}
+}
+
+func WithRegions(regions ...*State) StateOption {
+	return func(s *State) {
+		WithChildren(regions...)(s)
+		s.initialChild = nil
+		s.parallel = true
+	}
+}
+
+func WithInitialChild(child *State) StateOption {
+	return func(s *State) {
+		s.initialChild = child
+	}
+}
+
 type State struct {
+	parent       *State
+	children     []*State
+	initialChild *State
+	histories    []*State
+	history      History
+	parallel     bool
+	timeouts     []timeout
 	*Named
 	*Callbacks
 }
@@ -9,6 +54,7 @@ func NewState(
 	name string,
 	enterCallback Callback,
 	exitCallback Callback,
+	opts ...StateOption,
 ) *State {
 	s := State{
 		Named: NewNamed(name),
@@ -18,5 +64,50 @@ func NewState(
 		),
 	}
 
+	for _, opt := range opts {
+		opt(&s)
+	}
+
 	return &s
 }
+
+func (s *State) GetParent() *State {
+	return s.parent
+}
+
+func (s *State) GetChildren() []*State {
+	return s.children
+}
+
+func (s *State) GetInitialChild() *State {
+	return s.initialChild
+}
+
+func (s *State) IsParallel() bool {
+	return s.parallel
+}
+
+func (s *State) GetHistory() History {
+	return s.history
+}
+
+func (s *State) isDescendantOf(ancestor *State) bool {
+	for parent := s.parent; parent != nil; parent = parent.parent {
+		if parent == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parallel states are skipped so a transition between regions exits and re-enters the parallel state as a whole
+func lowestCommonCompoundAncestor(source *State, destination *State) *State {
+	for ancestor := source.parent; ancestor != nil; ancestor = ancestor.parent {
+		if !ancestor.parallel && destination.isDescendantOf(ancestor) {
+			return ancestor
+		}
+	}
+
+	return nil
+}
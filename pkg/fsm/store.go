@@ -0,0 +1,19 @@
+package fsm
+
+import (
+	"context"
+)
+
+type Store interface {
+	Load(ctx context.Context, id string) (Snapshot, error)
+	Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion int64) error
+}
+
+func WithStore(store Store, id string) MachineOption {
+	return func(m *Machine) error {
+		m.store = store
+		m.storeID = id
+
+		return nil
+	}
+}
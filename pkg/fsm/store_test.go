@@ -0,0 +1,199 @@
+package fsm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+)
+
+func testStore(t *testing.T, store Store) {
+	_, err := store.Load(context.Background(), "connector/1")
+	require.ErrorIs(t, err, ErrSnapshotNotFound)
+
+	compensated := false
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", nil, nil)
+		stateB := NewState("state_b", nil, nil)
+
+		onEnter := func(scope Scope) (context.Context, error) {
+			scope.Compensate(func(ctx context.Context) error {
+				compensated = true
+				return nil
+			})
+
+			return scope.Context, nil
+		}
+
+		return NewMachine(
+			[]*State{stateA, stateB},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, onEnter, nil),
+				NewTransition("transition_b_a", stateB, stateA, onEnter, nil),
+			},
+			stateA,
+			append([]MachineOption{WithStore(store, "connector/1")}, opts...)...,
+		)
+	}
+
+	m1, err := newMachine()
+	require.NoError(t, err)
+
+	m2, err := newMachine()
+	require.NoError(t, err)
+
+	_, err = m1.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	snapshot, err := store.Load(context.Background(), "connector/1")
+	require.NoError(t, err)
+	require.Equal(t, "state_b", snapshot.State)
+	require.Equal(t, int64(1), snapshot.Version)
+
+	_, err = m2.Transition("transition_a_b", context.Background())
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrVersionConflict))
+	require.True(t, compensated)
+	require.Equal(t, "state_a", m2.State())
+	require.Equal(t, int64(0), m2.Snapshot().Version)
+
+	m3, err := newMachine(WithRestoredState(snapshot))
+	require.NoError(t, err)
+	require.Equal(t, "state_b", m3.State())
+
+	_, err = m3.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	_, err = m1.Transition("transition_b_a", context.Background())
+	require.ErrorIs(t, err, ErrVersionConflict)
+	require.Equal(t, "state_b", m1.State())
+
+	snapshot, err = store.Load(context.Background(), "connector/1")
+	require.NoError(t, err)
+	require.Equal(t, "state_a", snapshot.State)
+	require.Equal(t, int64(2), snapshot.Version)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	testStore(t, store)
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "stato.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err = NewSQLStore(db, "snapshots; DROP TABLE snapshots")
+	require.Error(t, err)
+
+	store, err := NewSQLStore(db, "snapshots")
+	require.NoError(t, err)
+
+	err = store.CreateTable(context.Background())
+	require.NoError(t, err)
+
+	testStore(t, store)
+
+	_, err = NewSQLStore(db, "snapshots", WithPlaceholder(Placeholder(-1)))
+	require.ErrorIs(t, err, ErrInvalidOption)
+
+	store, err = NewSQLStore(db, "dollar_snapshots", WithPlaceholder(DollarPlaceholder))
+	require.NoError(t, err)
+
+	err = store.CreateTable(context.Background())
+	require.NoError(t, err)
+
+	testStore(t, store)
+}
+
+type failingJournal struct {
+	journal *MemoryJournal
+	fail    bool
+}
+
+func (j *failingJournal) Append(ctx context.Context, entry JournalEntry) error {
+	if j.fail {
+		return fmt.Errorf("journal unavailable")
+	}
+
+	return j.journal.Append(ctx, entry)
+}
+
+func TestStoreWithJournal(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	journal := &failingJournal{journal: NewMemoryJournal(), fail: true}
+
+	newMachine := func(opts ...MachineOption) (*Machine, error) {
+		stateA := NewState("state_a", nil, nil)
+		stateB := NewState("state_b", nil, nil)
+
+		return NewMachine(
+			[]*State{stateA, stateB},
+			[]*Transition{
+				NewTransition("transition_a_b", stateA, stateB, nil, nil),
+				NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			},
+			stateA,
+			append([]MachineOption{WithStore(store, "connector/1")}, opts...)...,
+		)
+	}
+
+	m, err := newMachine(WithJournal(journal))
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.Error(t, err)
+	require.Equal(t, "state_a", m.State())
+	require.Equal(t, int64(0), m.Snapshot().Version)
+
+	_, err = store.Load(context.Background(), "connector/1")
+	require.ErrorIs(t, err, ErrSnapshotNotFound)
+
+	journal.fail = false
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	snapshot, err := store.Load(context.Background(), "connector/1")
+	require.NoError(t, err)
+	require.Equal(t, "state_b", snapshot.State)
+	require.Equal(t, int64(1), snapshot.Version)
+
+	other, err := newMachine(WithRestoredState(snapshot))
+	require.NoError(t, err)
+
+	_, err = other.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.ErrorIs(t, err, ErrVersionConflict)
+	require.Equal(t, "state_b", m.State())
+
+	entries := journal.journal.Entries()
+	require.Len(t, entries, 3)
+	require.Equal(t, "", entries[0].Error)
+	require.Equal(t, "state_a", entries[1].Destination)
+	require.Equal(t, "", entries[1].Error)
+	require.NotEmpty(t, entries[2].Error)
+	require.True(t, entries[2].Aborted)
+
+	replayed, err := newMachine()
+	require.NoError(t, err)
+
+	err = replayed.Replay(context.Background(), entries)
+	require.NoError(t, err)
+	require.Equal(t, "state_b", replayed.State())
+	require.Equal(t, int64(1), replayed.Snapshot().Version)
+}
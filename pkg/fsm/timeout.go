@@ -0,0 +1,120 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type timeout struct {
+	duration   time.Duration
+	transition string
+}
+
+func WithTimeout(duration time.Duration, transition string) StateOption {
+	return func(s *State) {
+		s.timeouts = append(s.timeouts, timeout{duration: duration, transition: transition})
+	}
+}
+
+type pendingTimer struct {
+	state    *State
+	timeout  timeout
+	deadline time.Time
+	timer    Timer
+}
+
+func (m *Machine) startTimers(states []*State) []*pendingTimer {
+	started := make([]*pendingTimer, 0)
+
+	now := m.clock.Now()
+
+	// timers armed during a replay run from when the entry was recorded, as they did originally
+	if !m.replayTimestamp.IsZero() {
+		now = m.replayTimestamp
+	}
+
+	for _, state := range states {
+		for _, timeout := range state.timeouts {
+			started = append(started, m.startTimer(state, timeout, now.Add(timeout.duration)))
+		}
+	}
+
+	return started
+}
+
+func (m *Machine) startTimer(state *State, timeout timeout, deadline time.Time) *pendingTimer {
+	p := &pendingTimer{
+		state:    state,
+		timeout:  timeout,
+		deadline: deadline,
+	}
+
+	m.timers[p] = true
+
+	duration := deadline.Sub(m.clock.Now())
+	if duration < 0 {
+		duration = 0
+	}
+
+	p.timer = m.clock.AfterFunc(duration, func() {
+		_, _ = m.dispatch(context.Background(), request{kind: timeoutRequest, timer: p})
+	})
+
+	return p
+}
+
+func (m *Machine) stopTimers(states []*State) []*pendingTimer {
+	stopped := make([]*pendingTimer, 0)
+
+	exited := make(stateSet)
+	for _, state := range states {
+		exited[state] = true
+	}
+
+	for p := range m.timers {
+		if !exited[p.state] {
+			continue
+		}
+
+		p.timer.Stop()
+		delete(m.timers, p)
+
+		stopped = append(stopped, p)
+	}
+
+	return stopped
+}
+
+func (m *Machine) handleTimeout(ctx context.Context, p *pendingTimer) (context.Context, error) {
+	// the state may have been exited after the timer fired but before the lock was taken
+	if !m.timers[p] {
+		return ctx, nil
+	}
+
+	delete(m.timers, p)
+
+	// only the timed out state and its ancestors are considered, not same-named transitions in other regions
+	transitionBySource := make(map[*State][]*Transition)
+	for state := p.state; state != nil; state = state.parent {
+		transitionBySource[state] = m.transitionBySourceByName[p.timeout.transition][state]
+	}
+
+	ctx, err := m.handleTransitionFrom(ctx, p.timeout.transition, transitionBySource)
+	if err != nil {
+		// a rejected or failed timeout leaves the state active, so it's given another full duration rather than
+		// being left without its timeout
+		if m.active[p.state] {
+			m.startTimer(p.state, p.timeout, m.clock.Now().Add(p.timeout.duration))
+		}
+
+		m.publish()
+
+		return nil, fmt.Errorf(
+			"state %#+v timeout after %v: %w",
+			p.state.Name(), p.timeout.duration, err,
+		)
+	}
+
+	return ctx, nil
+}
@@ -0,0 +1,161 @@
+package fsm
+
+import (
+	"context"
+	"github.com/initialed85/stato/pkg/fsm/fsmtest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMachineTimeout(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := fsmtest.NewFakeClock(start)
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithTimeout(time.Second*10, "transition_b_a"))
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+			NewTransition("transition_b_b", stateB, stateB, nil, nil),
+		},
+		stateA,
+		WithClock(clock),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0, clock.Pending())
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, clock.Pending())
+	require.Equal(t, start, m.Snapshot().Timestamp)
+
+	clock.Advance(time.Second * 9)
+	require.Equal(t, stateB.Name(), m.State())
+
+	_, err = m.Transition("transition_b_b", context.Background())
+	require.NoError(t, err)
+
+	clock.Advance(time.Second * 1)
+	require.Equal(t, stateA.Name(), m.State())
+	require.Equal(t, start.Add(time.Second*10), m.Snapshot().Timestamp)
+	require.Equal(t, 0, clock.Pending())
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Transition("transition_b_a", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, clock.Pending())
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, stateA.Name(), m.State())
+
+	m, err = NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_b_a", stateB, stateA, nil, nil),
+		},
+		stateB,
+		WithClock(clock),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1, clock.Pending())
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, stateA.Name(), m.State())
+
+	_, err = NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{},
+		stateA,
+	)
+	require.Error(t, err)
+}
+
+func TestMachineTimeoutRegions(t *testing.T) {
+	clock := fsmtest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	stateA1 := NewState("state_a_1", nil, nil, WithTimeout(time.Second*10, "transition_next"))
+	stateA2 := NewState("state_a_2", nil, nil)
+	stateA := NewState("state_a", nil, nil, WithChildren(stateA1, stateA2))
+	stateB1 := NewState("state_b_1", nil, nil)
+	stateB2 := NewState("state_b_2", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithChildren(stateB1, stateB2))
+	stateP := NewState("state_p", nil, nil, WithRegions(stateA, stateB))
+
+	m, err := NewMachine(
+		[]*State{stateP},
+		[]*Transition{
+			NewTransition("transition_next", stateA1, stateA2, nil, nil),
+			NewTransition("transition_next", stateB1, stateB2, nil, nil),
+		},
+		stateP,
+		WithClock(clock),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{stateA1.Name(), stateB1.Name()}, m.Configuration())
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, []string{stateA2.Name(), stateB1.Name()}, m.Configuration())
+}
+
+func TestMachineTimeoutRejected(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := fsmtest.NewFakeClock(start)
+
+	allowed := false
+	failures := make([]error, 0)
+
+	stateA := NewState("state_a", nil, nil)
+	stateB := NewState("state_b", nil, nil, WithTimeout(time.Second*10, "transition_b_a"))
+
+	journal := NewMemoryJournal()
+
+	m, err := NewMachine(
+		[]*State{stateA, stateB},
+		[]*Transition{
+			NewTransition("transition_a_b", stateA, stateB, nil, nil),
+			NewTransition("transition_b_a", stateB, stateA, nil, nil, WithGuard(func(scope Scope) bool {
+				return allowed
+			})),
+		},
+		stateA,
+		WithClock(clock),
+		WithJournal(journal),
+	)
+	require.NoError(t, err)
+
+	m.AddListener(ListenerFuncs{
+		TransitionFailedFunc: func(scope Scope, err error) {
+			failures = append(failures, err)
+		},
+	})
+
+	_, err = m.Transition("transition_a_b", context.Background())
+	require.NoError(t, err)
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, stateB.Name(), m.State())
+	require.Len(t, failures, 1)
+	require.ErrorIs(t, failures[0], ErrGuardRejected)
+	require.Equal(t, 1, clock.Pending())
+	require.Equal(
+		t,
+		[]TimerSnapshot{{State: "state_b", Transition: "transition_b_a", Deadline: start.Add(time.Second * 20)}},
+		m.Snapshot().Timers,
+	)
+
+	entries := journal.Entries()
+	require.Equal(t, TimeoutEntry, entries[len(entries)-1].Kind)
+	require.NotEmpty(t, entries[len(entries)-1].Error)
+
+	allowed = true
+
+	clock.Advance(time.Second * 10)
+	require.Equal(t, stateA.Name(), m.State())
+	require.Equal(t, 0, clock.Pending())
+}
@@ -1,8 +1,24 @@
 package fsm
 
+type TransitionOption func(t *Transition)
+
+func WithGuard(guard Guard) TransitionOption {
+	return func(t *Transition) {
+		t.guard = guard
+	}
+}
+
+func WithEvent(event *Event) TransitionOption {
+	return func(t *Transition) {
+		t.event = event
+	}
+}
+
 type Transition struct {
 	source      *State
 	destination *State
+	guard       Guard
+	event       *Event
 	*Named
 	*Callbacks
 }
@@ -13,6 +29,7 @@ func NewTransition(
 	destination *State,
 	enterCallback Callback,
 	exitCallback Callback,
+	opts ...TransitionOption,
 ) *Transition {
 	t := Transition{
 		source:      source,
@@ -32,6 +49,10 @@ func NewTransition(
 		panic("destination state unexpectedly nil")
 	}
 
+	for _, opt := range opts {
+		opt(&t)
+	}
+
 	return &t
 }
 
@@ -42,3 +63,19 @@ func (t *Transition) GetSource() *State {
 func (t *Transition) GetDestination() *State {
 	return t.destination
 }
+
+func (t *Transition) GetEvent() *Event {
+	return t.event
+}
+
+func (t *Transition) HasGuard() bool {
+	return t.guard != nil
+}
+
+func (t *Transition) allowed(scope Scope) bool {
+	if t.guard == nil {
+		return true
+	}
+
+	return t.guard(scope)
+}